@@ -17,8 +17,57 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// InstanceIDLabelKey is the label holding the stable instance ID of a pod when spec.podNaming is
+	// Random or Ordinal. A pod replacing another one during a revision update inherits its instance ID.
+	InstanceIDLabelKey = "workload.scott.dev/instance-id"
+
+	// RoleLabelKey is the label holding the role of a pod in the rollout, one of the PodRole values.
+	// It is kept up to date by the controller as revisions change.
+	RoleLabelKey = "workload.scott.dev/role"
+
+	// AdoptAnnotationKey opts an orphaned pod out of adoption when set to "false", e.g. for debug pods
+	// created with labels copied from the workload.
+	AdoptAnnotationKey = "workload.scott.dev/adopt"
+
+	// CanaryOverridesAnnotationKey marks the pods created with spec.canaryOverrides applied. They are replaced one
+	// at a time by pods without the overrides once the rollout completes, each once all pods are available.
+	CanaryOverridesAnnotationKey = "workload.scott.dev/canary-overrides"
+
+	// UnknownRevisionHash is the controller-revision-hash label of adopted pods that match none of the
+	// revisions of their PartitionWorkload. They count as stale and are replaced by rollouts.
+	UnknownRevisionHash = "unknown"
+
+	// MigrateFromAnnotationKey names a Deployment in the namespace of a PartitionWorkload to migrate from. The
+	// controller takes over the pods of the Deployment that match the selector, without restarting them, then
+	// scales the Deployment to zero. Progress is reported by the Migrated condition.
+	MigrateFromAnnotationKey = "workload.scott.dev/migrate-from"
+
+	// ChangeCauseAnnotationKey is copied from a PartitionWorkload to the revisions created for it and shown in
+	// status.revisionHistory, as kubectl rollout history does for Deployments.
+	ChangeCauseAnnotationKey = "kubernetes.io/change-cause"
+
+	// CompletedAtAnnotationKey and CompletedReplicasAnnotationKey record on a revision when a rollout to it last
+	// completed, in RFC 3339, and the number of replicas at that time.
+	CompletedAtAnnotationKey       = "workload.scott.dev/completed-at"
+	CompletedReplicasAnnotationKey = "workload.scott.dev/completed-replicas"
+)
+
+type PodRole string
+
+const (
+	// PodRoleStable is the role of pods at currentRevision
+	PodRoleStable PodRole = "stable"
+	// PodRoleCanary is the role of pods at updateRevision while it differs from currentRevision
+	PodRoleCanary PodRole = "canary"
+	// PodRoleStale is the role of pods at any other revision
+	PodRoleStale PodRole = "stale"
 )
 
 // PartitionWorkloadSpec defines the desired state of PartitionWorkload
@@ -43,6 +92,26 @@ type PartitionWorkloadSpec struct {
 	// +kubebuilder:validation:Schemaless
 	Template v1.PodTemplateSpec `json:"template"`
 
+	// MinReadySeconds is the minimum number of seconds a newly ready pod must stay ready, without any of its
+	// containers crashing, to count as available. Defaults to 0, i.e. pods are available as soon as they are ready.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+
+	// RevisionHistoryLimit is the number of old ControllerRevisions kept for rollback, not counting the current
+	// and update revisions and revisions pods are still at. Defaults to the controller's
+	// --default-revision-history-limit, 10 unless configured otherwise.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// RevisionHashIgnore lists fields of the pod template that are left out of revisions, such as build IDs
+	// or restart timestamps injected by tools. Changing only those fields doesn't start a rollout. Ignored
+	// labels and annotations are updated on existing pods in place. Setting this field changes revisions
+	// that include any of the fields once, as they are recorded without them.
+	// +optional
+	RevisionHashIgnore *RevisionHashIgnore `json:"revisionHashIgnore,omitempty"`
+
 	// Partition describes the number of pods that are at the latest pod template revision
 	// when revision is made to spec.Template. The remaining rest of the pods
 	// (spec.Replicas - spec.Partition) can be of any version (but not the latest version).
@@ -52,6 +121,201 @@ type PartitionWorkloadSpec struct {
 	// If it is larger than spec.Replicas, it is clamped to be the same as spec.Replicas.
 	// +kubebuilder:validation:Minimum=0
 	Partition *int32 `json:"partition,omitempty"`
+
+	// Paused stops moving pods to the update revision. Pods already updated are kept, and scaling still
+	// happens at the revisions pods are currently at. Resuming continues the rollout towards spec.partition.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// PodNaming decides how pods are named. Generated lets the API server append a random suffix to
+	// "<name>-". Random and Ordinal give every pod a stable instance ID, a random string or the lowest
+	// free ordinal, recorded in the workload.scott.dev/instance-id label. Pods are then named
+	// "<name>-<pod-template-hash>-<instance ID>", and a pod replacing another one during a revision
+	// update reuses its instance ID. Defaults to Generated, or Ordinal if VolumeClaimTemplates are set.
+	// +kubebuilder:validation:Enum=Generated;Random;Ordinal
+	// +optional
+	PodNaming PodNamingPolicy `json:"podNaming,omitempty"`
+
+	// AdoptionPolicy decides which orphaned pods matching the selector are adopted. Always adopts all of them,
+	// Never adopts none, and IfRevisionMatches only adopts pods whose containers match a revision of the
+	// PartitionWorkload. Pods annotated with workload.scott.dev/adopt: "false" are never adopted.
+	// Defaults to Always.
+	// +kubebuilder:validation:Enum=Always;Never;IfRevisionMatches
+	// +optional
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// VolumeClaimTemplates are claims created once per pod instance ID and mounted into the pod as volumes
+	// of the same name. Claims are named "<template name>-<name>-<instance ID>", so a pod replacing another
+	// one during a revision update mounts the same claims. Setting templates requires instance IDs, so
+	// spec.podNaming defaults to Ordinal and may not be Generated. The templates are immutable.
+	// +optional
+	VolumeClaimTemplates []v1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
+	// PersistentVolumeClaimRetentionPolicy describes what happens to the claims created from
+	// VolumeClaimTemplates when the PartitionWorkload is deleted, or scaled down and an instance ID is
+	// released. Claims are retained by default.
+	// +optional
+	PersistentVolumeClaimRetentionPolicy *apps.StatefulSetPersistentVolumeClaimRetentionPolicy `json:"persistentVolumeClaimRetentionPolicy,omitempty"`
+
+	// CanaryOverrides is a strategic merge patch of the pod template, applied only to pods created at the
+	// update revision while the rollout is partial, e.g.
+	// {"metadata":{"labels":{"track":"canary"}},"spec":{"priorityClassName":"canary"}}.
+	// It is not part of the revision, so changing it does not start a rollout. Pods keep the overrides
+	// they were created with until currentRevision catches up with updateRevision, then they are replaced
+	// one at a time by pods without them.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	CanaryOverrides *runtime.RawExtension `json:"canaryOverrides,omitempty"`
+
+	// TrafficRouting, if set, makes the controller split traffic between the current and update
+	// revisions through a Gateway API HTTPRoute as the partition advances.
+	// +optional
+	TrafficRouting *TrafficRouting `json:"trafficRouting,omitempty"`
+
+	// Analysis, if set, gates the rollout on metric queries. Pods are only moved to the update revision
+	// beyond the first canary pod while the metrics pass.
+	// +optional
+	Analysis *Analysis `json:"analysis,omitempty"`
+
+	// Gates are HTTP(S) endpoints that must approve the update revision before pods are moved to it.
+	// While any gate has not approved the revision, the rollout holds at the pods already updated.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Gates []RolloutGate `json:"gates,omitempty"`
+}
+
+type AdoptionPolicy string
+
+const (
+	AdoptionPolicyAlways            AdoptionPolicy = "Always"
+	AdoptionPolicyNever             AdoptionPolicy = "Never"
+	AdoptionPolicyIfRevisionMatches AdoptionPolicy = "IfRevisionMatches"
+)
+
+type PodNamingPolicy string
+
+const (
+	PodNamingGenerated PodNamingPolicy = "Generated"
+	PodNamingRandom    PodNamingPolicy = "Random"
+	PodNamingOrdinal   PodNamingPolicy = "Ordinal"
+)
+
+// RevisionHashIgnore describes the fields of the pod template that are not part of revisions.
+type RevisionHashIgnore struct {
+	// Labels are keys of pod template labels. They may not be used by the selector, nor be one of the labels
+	// the controller sets on pods.
+	// +listType=set
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+
+	// Annotations are keys of pod template annotations.
+	// +listType=set
+	// +optional
+	Annotations []string `json:"annotations,omitempty"`
+
+	// Paths are JSON pointers to pod template fields that can be updated in place: /spec/containers/<index>/image,
+	// /spec/initContainers/<index>/image, /spec/activeDeadlineSeconds and /spec/tolerations. Pods are patched
+	// when they change, as far as the apiserver allows: an active deadline is only lowered, and tolerations are
+	// only added.
+	// +listType=set
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+}
+
+// TrafficRouting describes the HTTPRoute and Services used to split traffic between revisions.
+type TrafficRouting struct {
+	// HTTPRoute is the name of the gateway.networking.k8s.io HTTPRoute in the PartitionWorkload's
+	// namespace whose backend weights are managed by the controller.
+	// +required
+	HTTPRoute string `json:"httpRoute"`
+
+	// StableService is the name of the Service that receives traffic for pods at currentRevision.
+	// The controller points its selector at the pod-template-hash of currentRevision.
+	// +required
+	StableService string `json:"stableService"`
+
+	// CanaryService is the name of the Service that receives traffic for pods at updateRevision.
+	// The controller points its selector at the pod-template-hash of updateRevision.
+	// +required
+	CanaryService string `json:"canaryService"`
+
+	// CanaryWeight is the explicit weight (out of 100) given to CanaryService while the rollout is partial.
+	// If unspecified, weights follow the proportion of ready pods at each revision.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	CanaryWeight *int32 `json:"canaryWeight,omitempty"`
+}
+
+// Analysis describes metric queries evaluated against a Prometheus-compatible HTTP API while a rollout is partial.
+type Analysis struct {
+	// Address is the base URL of the Prometheus-compatible HTTP API, e.g. http://prometheus.monitoring:9090.
+	// +required
+	Address string `json:"address"`
+
+	// Interval is how often the metrics are evaluated while pods exist at the update revision.
+	// The first evaluation happens one interval after the rollout starts. Defaults to 1m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// FailurePolicy decides what happens when a metric fails its threshold. Hold stops moving pods to the
+	// update revision until the metrics pass again. Rollback moves every pod back to the current revision
+	// until the pod template changes. Defaults to Hold.
+	// +kubebuilder:validation:Enum=Hold;Rollback
+	// +optional
+	FailurePolicy AnalysisFailurePolicy `json:"failurePolicy,omitempty"`
+
+	// Metrics are the queries to evaluate. All of them must pass for the rollout to advance.
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	Metrics []AnalysisMetric `json:"metrics"`
+}
+
+type AnalysisFailurePolicy string
+
+const (
+	AnalysisFailurePolicyHold     AnalysisFailurePolicy = "Hold"
+	AnalysisFailurePolicyRollback AnalysisFailurePolicy = "Rollback"
+)
+
+// AnalysisMetric is an instant query with the range its result must fall in.
+type AnalysisMetric struct {
+	// Name identifies the metric in status.
+	// +required
+	Name string `json:"name"`
+
+	// Query is a PromQL instant query returning a scalar or a single-sample vector. It is a go template
+	// that can reference .Name, .Namespace, .CurrentRevision, .UpdateRevision, .CurrentRevisionHash
+	// and .UpdateRevisionHash, where the hashes are the pod-template-hash label values of the revisions.
+	// +required
+	Query string `json:"query"`
+
+	// Min is the lowest passing value of the query result, as a decimal number.
+	// +optional
+	Min *string `json:"min,omitempty"`
+
+	// Max is the highest passing value of the query result, as a decimal number.
+	// +optional
+	Max *string `json:"max,omitempty"`
+}
+
+// RolloutGate is an HTTP(S) endpoint that decides whether the rollout may advance.
+//
+// The controller POSTs a JSON payload describing the PartitionWorkload, its revisions and ready counts to URL
+// and expects a 200 response with a JSON body of the form {"advance": true, "message": "..."}. Other responses
+// and unreachable endpoints hold the rollout and are retried with exponential backoff. Answers are cached per
+// update revision; an approval is final for the revision while a hold is asked again after the backoff.
+type RolloutGate struct {
+	// Name identifies the gate in status.
+	// +required
+	Name string `json:"name"`
+
+	// URL is the http or https endpoint the payload is POSTed to.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +required
+	URL string `json:"url"`
 }
 
 // PartitionWorkloadStatus defines the observed state of PartitionWorkload.
@@ -64,15 +328,38 @@ type PartitionWorkloadStatus struct {
 	// +kubebuilder:validation:Minimum=0
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
-	// ReadyReplicas is the number of Pods created by the PartitionWorkload controller
+	// Replicas is the number of Pods created by the PartitionWorkload controller. It is serialized as
+	// readyReplicas, the key it has always had in this version; v1beta1 serves it as replicas.
 	// +kubebuilder:validation:Minimum=0
 	Replicas int32 `json:"readyReplicas"`
 
+	// ReadyReplicas is the number of Pods with a Ready condition. It is serialized as readyPods, as readyReplicas
+	// holds Replicas in this version; v1beta1 serves it as readyReplicas.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ReadyReplicas int32 `json:"readyPods,omitempty"`
+
+	// AvailableReplicas is the number of Pods that have been ready for at least spec.minReadySeconds.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+
+	// CurrentReplicas is the number of Pods created by the PartitionWorkload controller from the PartitionWorkload
+	// version indicated by currentRevision.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	CurrentReplicas int32 `json:"currentReplicas,omitempty"`
+
 	// UpdatedReplicas is the number of Pods created by the PartitionWorkload controller from the PartitionWorkload version
 	// indicated by updateRevision.
 	// +kubebuilder:validation:Minimum=0
 	UpdatedReplicas int32 `json:"updatedReplicas"`
 
+	// UpdatedReadyReplicas is the number of Pods at updateRevision with a Ready condition.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	UpdatedReadyReplicas int32 `json:"updatedReadyReplicas,omitempty"`
+
 	// CurrentRevision, if not empty, indicates the current revision version of the PartitionWorkload.
 	CurrentRevision string `json:"currentRevision,omitempty"`
 
@@ -84,21 +371,176 @@ type PartitionWorkloadStatus struct {
 	// newest ControllerRevision.
 	CollisionCount *int32 `json:"collisionCount,omitempty"`
 
+	// LabelSelector is spec.selector in string form, used by the scale subresource to find the pods
+	// counted by HorizontalPodAutoscalers.
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+
 	// Conditions represents the latest available observations of a PartitionWorkload's current state.
+	// v1beta1 serves them as metav1.Conditions.
+	// +optional
 	Conditions []PartitionWorkloadCondition `json:"conditions,omitempty"`
+
+	// Analysis is the latest result of the metric analysis for the update revision.
+	// +optional
+	Analysis *AnalysisStatus `json:"analysis,omitempty"`
+
+	// Gates is the latest result of each rollout gate for the update revision.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Gates []GateStatus `json:"gates,omitempty"`
+
+	// RevisionHistory summarizes the revisions of the PartitionWorkload, oldest first, like kubectl rollout
+	// history does for Deployments.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	RevisionHistory []RevisionHistoryEntry `json:"revisionHistory,omitempty"`
+}
+
+// RevisionHistoryEntry summarizes a ControllerRevision of a PartitionWorkload.
+type RevisionHistoryEntry struct {
+	// Name of the ControllerRevision.
+	Name string `json:"name"`
+
+	// Revision is the number of the revision, which grows with every rollout, including rollbacks.
+	Revision int64 `json:"revision"`
+
+	// ChangeCause is the kubernetes.io/change-cause annotation of the PartitionWorkload when the revision was created.
+	// +optional
+	ChangeCause string `json:"changeCause,omitempty"`
+
+	// CreationTime is when the revision was created.
+	CreationTime metav1.Time `json:"creationTime"`
+
+	// CompletionTime is when a rollout to the revision last completed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Replicas is the number of replicas when a rollout to the revision last completed.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
 }
 
-type PartitionWorkloadConditionType string
+type GatePhase string
 
 const (
-	PartionWorkloadConditionFailedScale PartitionWorkloadConditionType = "FailedScale"
+	// GatePhasePending means the gate has not answered yet, or could not be reached.
+	GatePhasePending GatePhase = "Pending"
+	// GatePhaseApproved means the gate approved the update revision.
+	GatePhaseApproved GatePhase = "Approved"
+	// GatePhaseHeld means the gate answered that the rollout must not advance yet.
+	GatePhaseHeld GatePhase = "Held"
 )
 
+// GateStatus records the latest answer of a rollout gate.
+type GateStatus struct {
+	// Name of the gate.
+	Name string `json:"name"`
+
+	// Revision is the update revision the gate was asked about.
+	Revision string `json:"revision"`
+
+	// Phase is Pending, Approved or Held.
+	Phase GatePhase `json:"phase"`
+
+	// Message is the message of the gate's response, or the reason it could not be reached.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastCheckTime is when the gate was last called.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+}
+
+type AnalysisPhase string
+
+const (
+	// AnalysisPhasePending means the metrics have not been evaluated yet for the update revision.
+	AnalysisPhasePending AnalysisPhase = "Pending"
+	// AnalysisPhaseSuccessful means every metric passed its threshold.
+	AnalysisPhaseSuccessful AnalysisPhase = "Successful"
+	// AnalysisPhaseInconclusive means no metric failed but at least one could not be evaluated.
+	AnalysisPhaseInconclusive AnalysisPhase = "Inconclusive"
+	// AnalysisPhaseFailed means at least one metric failed its threshold.
+	AnalysisPhaseFailed AnalysisPhase = "Failed"
+)
+
+// AnalysisStatus records the metric analysis of an update revision.
+type AnalysisStatus struct {
+	// Revision is the update revision the metrics were evaluated for.
+	Revision string `json:"revision"`
+
+	// Phase is the overall result of the latest evaluation.
+	Phase AnalysisPhase `json:"phase"`
+
+	// StartTime is when the analysis of the revision started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// LastEvaluationTime is when the metrics were last evaluated.
+	// +optional
+	LastEvaluationTime *metav1.Time `json:"lastEvaluationTime,omitempty"`
+
+	// Metrics holds the result of each metric in the latest evaluation.
+	// +optional
+	Metrics []MetricResult `json:"metrics,omitempty"`
+}
+
+// MetricResult is the result of a single metric query.
+type MetricResult struct {
+	// Name of the metric.
+	Name string `json:"name"`
+
+	// Phase is Successful, Inconclusive or Failed.
+	Phase AnalysisPhase `json:"phase"`
+
+	// Value is the value returned by the query.
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// Message explains why the metric failed or was inconclusive.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Condition types of a PartitionWorkload, following the conventions of Deployments where they overlap.
+const (
+	// PartitionWorkloadConditionAvailable is True when every desired replica is available.
+	PartitionWorkloadConditionAvailable = "Available"
+	// PartitionWorkloadConditionProgressing is True while the rollout moves towards the partition or has
+	// reached it, Unknown while it is paused and False when the analysis of the update revision failed.
+	PartitionWorkloadConditionProgressing = "Progressing"
+	// PartitionWorkloadConditionReplicaFailure is True when pods could not be created or deleted.
+	PartitionWorkloadConditionReplicaFailure = "ReplicaFailure"
+	// PartitionWorkloadConditionRolloutComplete is True when every desired replica is ready at the update
+	// revision and it has become the current revision.
+	PartitionWorkloadConditionRolloutComplete = "RolloutComplete"
+	// PartitionWorkloadConditionFailedScale is True when the last scale or update of pods failed. It is
+	// removed once pods are synced again.
+	PartitionWorkloadConditionFailedScale = "FailedScale"
+	// PartitionWorkloadConditionSelectorOverlap is True when pods matching the selector are controlled by
+	// another owner, which the PartitionWorkload then can't claim. It is removed once no such pods are left.
+	PartitionWorkloadConditionSelectorOverlap = "SelectorOverlap"
+	// PartitionWorkloadConditionMigrated is set while migrating from the Deployment named by the
+	// workload.scott.dev/migrate-from annotation. It is True once the Deployment is scaled to zero.
+	PartitionWorkloadConditionMigrated = "Migrated"
+
+	// Deprecated: use PartitionWorkloadConditionFailedScale.
+	PartionWorkloadConditionFailedScale = PartitionWorkloadConditionFailedScale
+)
+
+// PartitionWorkloadCondition describes the state of a PartitionWorkload at a certain point.
 type PartitionWorkloadCondition struct {
 	// Type of PartitionWorkload condition.
-	Type PartitionWorkloadConditionType `json:"type"`
+	Type string `json:"type"`
 	// Status of the condition, one of True, False, Unknown.
-	Status v1.ConditionStatus `json:"status"`
+	Status metav1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the .metadata.generation that the condition was set based upon.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Last time the condition is updated.
 	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
 	// Last time the condition transitioned from one status to another.
@@ -109,8 +551,35 @@ type PartitionWorkloadCondition struct {
 	Message string `json:"message,omitempty"`
 }
 
+// Reasons of the PartitionWorkload conditions.
+const (
+	ReasonMinimumReplicasAvailable   = "MinimumReplicasAvailable"
+	ReasonMinimumReplicasUnavailable = "MinimumReplicasUnavailable"
+	ReasonReplicasUpdating           = "ReplicasUpdating"
+	ReasonPartitionReached           = "PartitionReached"
+	ReasonRolloutPaused              = "RolloutPaused"
+	ReasonAnalysisFailed             = "AnalysisFailed"
+	ReasonRolloutInProgress          = "RolloutInProgress"
+	ReasonRolloutComplete            = "RolloutComplete"
+	ReasonFailedScale                = "FailedScale"
+	ReasonPodsOwnedByOther           = "PodsOwnedByOther"
+	ReasonMigrationInProgress        = "MigrationInProgress"
+	ReasonMigrationComplete          = "MigrationComplete"
+	ReasonMigrationFailed            = "MigrationFailed"
+)
+
 // +kubebuilder:object:root=true
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.readyReplicas,selectorpath=.status.labelSelector
+// +kubebuilder:resource:shortName=pw,categories=all
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`,description="The desired number of pods"
+// +kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.readyReplicas`,description="The number of pods created by the PartitionWorkload"
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyPods`,description="The number of ready pods"
+// +kubebuilder:printcolumn:name="Updated",type=integer,JSONPath=`.status.updatedReplicas`,description="The number of pods at the update revision"
+// +kubebuilder:printcolumn:name="Partition",type=integer,JSONPath=`.spec.partition`,description="The number of pods desired at the update revision"
+// +kubebuilder:printcolumn:name="Revision",type=string,JSONPath=`.status.updateRevision`,description="The update revision"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // PartitionWorkload is the Schema for the partitionworkloads API
 type PartitionWorkload struct {
@@ -21,10 +21,126 @@ limitations under the License.
 package v1alpha1
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Analysis) DeepCopyInto(out *Analysis) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]AnalysisMetric, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Analysis.
+func (in *Analysis) DeepCopy() *Analysis {
+	if in == nil {
+		return nil
+	}
+	out := new(Analysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalysisMetric) DeepCopyInto(out *AnalysisMetric) {
+	*out = *in
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		*out = new(string)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalysisMetric.
+func (in *AnalysisMetric) DeepCopy() *AnalysisMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalysisMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalysisStatus) DeepCopyInto(out *AnalysisStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastEvaluationTime != nil {
+		in, out := &in.LastEvaluationTime, &out.LastEvaluationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]MetricResult, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalysisStatus.
+func (in *AnalysisStatus) DeepCopy() *AnalysisStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalysisStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GateStatus) DeepCopyInto(out *GateStatus) {
+	*out = *in
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GateStatus.
+func (in *GateStatus) DeepCopy() *GateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricResult) DeepCopyInto(out *MetricResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricResult.
+func (in *MetricResult) DeepCopy() *MetricResult {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PartitionWorkload) DeepCopyInto(out *PartitionWorkload) {
 	*out = *in
@@ -115,11 +231,53 @@ func (in *PartitionWorkloadSpec) DeepCopyInto(out *PartitionWorkloadSpec) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Template.DeepCopyInto(&out.Template)
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RevisionHashIgnore != nil {
+		in, out := &in.RevisionHashIgnore, &out.RevisionHashIgnore
+		*out = new(RevisionHashIgnore)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Partition != nil {
 		in, out := &in.Partition, &out.Partition
 		*out = new(int32)
 		**out = **in
 	}
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make([]corev1.PersistentVolumeClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PersistentVolumeClaimRetentionPolicy != nil {
+		in, out := &in.PersistentVolumeClaimRetentionPolicy, &out.PersistentVolumeClaimRetentionPolicy
+		*out = new(appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy)
+		**out = **in
+	}
+	if in.CanaryOverrides != nil {
+		in, out := &in.CanaryOverrides, &out.CanaryOverrides
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficRouting != nil {
+		in, out := &in.TrafficRouting, &out.TrafficRouting
+		*out = new(TrafficRouting)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Analysis != nil {
+		in, out := &in.Analysis, &out.Analysis
+		*out = new(Analysis)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Gates != nil {
+		in, out := &in.Gates, &out.Gates
+		*out = make([]RolloutGate, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PartitionWorkloadSpec.
@@ -147,6 +305,25 @@ func (in *PartitionWorkloadStatus) DeepCopyInto(out *PartitionWorkloadStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Analysis != nil {
+		in, out := &in.Analysis, &out.Analysis
+		*out = new(AnalysisStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Gates != nil {
+		in, out := &in.Gates, &out.Gates
+		*out = make([]GateStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RevisionHistory != nil {
+		in, out := &in.RevisionHistory, &out.RevisionHistory
+		*out = make([]RevisionHistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PartitionWorkloadStatus.
@@ -158,3 +335,93 @@ func (in *PartitionWorkloadStatus) DeepCopy() *PartitionWorkloadStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevisionHashIgnore) DeepCopyInto(out *RevisionHashIgnore) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionHashIgnore.
+func (in *RevisionHashIgnore) DeepCopy() *RevisionHashIgnore {
+	if in == nil {
+		return nil
+	}
+	out := new(RevisionHashIgnore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevisionHistoryEntry) DeepCopyInto(out *RevisionHistoryEntry) {
+	*out = *in
+	in.CreationTime.DeepCopyInto(&out.CreationTime)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionHistoryEntry.
+func (in *RevisionHistoryEntry) DeepCopy() *RevisionHistoryEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(RevisionHistoryEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutGate) DeepCopyInto(out *RolloutGate) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutGate.
+func (in *RolloutGate) DeepCopy() *RolloutGate {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutGate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficRouting) DeepCopyInto(out *TrafficRouting) {
+	*out = *in
+	if in.CanaryWeight != nil {
+		in, out := &in.CanaryWeight, &out.CanaryWeight
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficRouting.
+func (in *TrafficRouting) DeepCopy() *TrafficRouting {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficRouting)
+	in.DeepCopyInto(out)
+	return out
+}
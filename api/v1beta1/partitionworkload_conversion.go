@@ -0,0 +1,218 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+// ConvertTo converts this PartitionWorkload to the hub version (v1alpha1).
+func (src *PartitionWorkload) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*workloadv1alpha1.PartitionWorkload)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec.Replicas = src.Spec.Replicas
+	dst.Spec.Selector = src.Spec.Selector
+	dst.Spec.Template = src.Spec.Template
+	dst.Spec.MinReadySeconds = src.Spec.MinReadySeconds
+	dst.Spec.RevisionHistoryLimit = src.Spec.RevisionHistoryLimit
+	dst.Spec.RevisionHashIgnore = (*workloadv1alpha1.RevisionHashIgnore)(src.Spec.RevisionHashIgnore)
+	dst.Spec.PodNaming = workloadv1alpha1.PodNamingPolicy(src.Spec.PodNaming)
+	dst.Spec.AdoptionPolicy = workloadv1alpha1.AdoptionPolicy(src.Spec.AdoptionPolicy)
+	dst.Spec.VolumeClaimTemplates = src.Spec.VolumeClaimTemplates
+	dst.Spec.PersistentVolumeClaimRetentionPolicy = src.Spec.PersistentVolumeClaimRetentionPolicy
+
+	strategy := src.Spec.Strategy
+	dst.Spec.Partition = strategy.Partition
+	dst.Spec.Paused = strategy.Paused
+	dst.Spec.CanaryOverrides = strategy.CanaryOverrides
+	if strategy.TrafficRouting != nil {
+		dst.Spec.TrafficRouting = &workloadv1alpha1.TrafficRouting{
+			HTTPRoute:     strategy.TrafficRouting.HTTPRoute,
+			StableService: strategy.TrafficRouting.StableService,
+			CanaryService: strategy.TrafficRouting.CanaryService,
+			CanaryWeight:  strategy.TrafficRouting.CanaryWeight,
+		}
+	}
+	if strategy.Analysis != nil {
+		dst.Spec.Analysis = &workloadv1alpha1.Analysis{
+			Address:       strategy.Analysis.Address,
+			Interval:      strategy.Analysis.Interval,
+			FailurePolicy: workloadv1alpha1.AnalysisFailurePolicy(strategy.Analysis.FailurePolicy),
+		}
+		for _, metric := range strategy.Analysis.Metrics {
+			dst.Spec.Analysis.Metrics = append(dst.Spec.Analysis.Metrics, workloadv1alpha1.AnalysisMetric{
+				Name: metric.Name, Query: metric.Query, Min: metric.Min, Max: metric.Max,
+			})
+		}
+	}
+	for _, gate := range strategy.Gates {
+		dst.Spec.Gates = append(dst.Spec.Gates, workloadv1alpha1.RolloutGate{Name: gate.Name, URL: gate.URL})
+	}
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
+	dst.Status.AvailableReplicas = src.Status.AvailableReplicas
+	dst.Status.CurrentReplicas = src.Status.CurrentReplicas
+	dst.Status.UpdatedReplicas = src.Status.UpdatedReplicas
+	dst.Status.UpdatedReadyReplicas = src.Status.UpdatedReadyReplicas
+	dst.Status.CurrentRevision = src.Status.CurrentRevision
+	dst.Status.UpdateRevision = src.Status.UpdateRevision
+	dst.Status.CollisionCount = src.Status.CollisionCount
+	dst.Status.LabelSelector = src.Status.LabelSelector
+	// v1beta1 conditions don't record the last update, so the last transition is the latest one known
+	for _, cond := range src.Status.Conditions {
+		dst.Status.Conditions = append(dst.Status.Conditions, workloadv1alpha1.PartitionWorkloadCondition{
+			Type:               cond.Type,
+			Status:             cond.Status,
+			ObservedGeneration: cond.ObservedGeneration,
+			LastUpdateTime:     cond.LastTransitionTime,
+			LastTransitionTime: cond.LastTransitionTime,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+		})
+	}
+	if src.Status.Analysis != nil {
+		dst.Status.Analysis = &workloadv1alpha1.AnalysisStatus{
+			Revision:           src.Status.Analysis.Revision,
+			Phase:              workloadv1alpha1.AnalysisPhase(src.Status.Analysis.Phase),
+			StartTime:          src.Status.Analysis.StartTime,
+			LastEvaluationTime: src.Status.Analysis.LastEvaluationTime,
+		}
+		for _, result := range src.Status.Analysis.Metrics {
+			dst.Status.Analysis.Metrics = append(dst.Status.Analysis.Metrics, workloadv1alpha1.MetricResult{
+				Name:    result.Name,
+				Phase:   workloadv1alpha1.AnalysisPhase(result.Phase),
+				Value:   result.Value,
+				Message: result.Message,
+			})
+		}
+	}
+	for _, gate := range src.Status.Gates {
+		dst.Status.Gates = append(dst.Status.Gates, workloadv1alpha1.GateStatus{
+			Name:          gate.Name,
+			Revision:      gate.Revision,
+			Phase:         workloadv1alpha1.GatePhase(gate.Phase),
+			Message:       gate.Message,
+			LastCheckTime: gate.LastCheckTime,
+		})
+	}
+	for _, entry := range src.Status.RevisionHistory {
+		dst.Status.RevisionHistory = append(dst.Status.RevisionHistory, workloadv1alpha1.RevisionHistoryEntry(entry))
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version (v1alpha1) to this PartitionWorkload.
+func (dst *PartitionWorkload) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*workloadv1alpha1.PartitionWorkload)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec.Replicas = src.Spec.Replicas
+	dst.Spec.Selector = src.Spec.Selector
+	dst.Spec.Template = src.Spec.Template
+	dst.Spec.MinReadySeconds = src.Spec.MinReadySeconds
+	dst.Spec.RevisionHistoryLimit = src.Spec.RevisionHistoryLimit
+	dst.Spec.RevisionHashIgnore = (*RevisionHashIgnore)(src.Spec.RevisionHashIgnore)
+	dst.Spec.PodNaming = PodNamingPolicy(src.Spec.PodNaming)
+	dst.Spec.AdoptionPolicy = AdoptionPolicy(src.Spec.AdoptionPolicy)
+	dst.Spec.VolumeClaimTemplates = src.Spec.VolumeClaimTemplates
+	dst.Spec.PersistentVolumeClaimRetentionPolicy = src.Spec.PersistentVolumeClaimRetentionPolicy
+
+	strategy := &dst.Spec.Strategy
+	strategy.Partition = src.Spec.Partition
+	strategy.Paused = src.Spec.Paused
+	strategy.CanaryOverrides = src.Spec.CanaryOverrides
+	if src.Spec.TrafficRouting != nil {
+		strategy.TrafficRouting = &TrafficRouting{
+			HTTPRoute:     src.Spec.TrafficRouting.HTTPRoute,
+			StableService: src.Spec.TrafficRouting.StableService,
+			CanaryService: src.Spec.TrafficRouting.CanaryService,
+			CanaryWeight:  src.Spec.TrafficRouting.CanaryWeight,
+		}
+	}
+	if src.Spec.Analysis != nil {
+		strategy.Analysis = &Analysis{
+			Address:       src.Spec.Analysis.Address,
+			Interval:      src.Spec.Analysis.Interval,
+			FailurePolicy: AnalysisFailurePolicy(src.Spec.Analysis.FailurePolicy),
+		}
+		for _, metric := range src.Spec.Analysis.Metrics {
+			strategy.Analysis.Metrics = append(strategy.Analysis.Metrics, AnalysisMetric{
+				Name: metric.Name, Query: metric.Query, Min: metric.Min, Max: metric.Max,
+			})
+		}
+	}
+	for _, gate := range src.Spec.Gates {
+		strategy.Gates = append(strategy.Gates, RolloutGate{Name: gate.Name, URL: gate.URL})
+	}
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
+	dst.Status.AvailableReplicas = src.Status.AvailableReplicas
+	dst.Status.CurrentReplicas = src.Status.CurrentReplicas
+	dst.Status.UpdatedReplicas = src.Status.UpdatedReplicas
+	dst.Status.UpdatedReadyReplicas = src.Status.UpdatedReadyReplicas
+	dst.Status.CurrentRevision = src.Status.CurrentRevision
+	dst.Status.UpdateRevision = src.Status.UpdateRevision
+	dst.Status.CollisionCount = src.Status.CollisionCount
+	dst.Status.LabelSelector = src.Status.LabelSelector
+	for _, cond := range src.Status.Conditions {
+		dst.Status.Conditions = append(dst.Status.Conditions, metav1.Condition{
+			Type:               cond.Type,
+			Status:             cond.Status,
+			ObservedGeneration: cond.ObservedGeneration,
+			LastTransitionTime: cond.LastTransitionTime,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+		})
+	}
+	if src.Status.Analysis != nil {
+		dst.Status.Analysis = &AnalysisStatus{
+			Revision:           src.Status.Analysis.Revision,
+			Phase:              AnalysisPhase(src.Status.Analysis.Phase),
+			StartTime:          src.Status.Analysis.StartTime,
+			LastEvaluationTime: src.Status.Analysis.LastEvaluationTime,
+		}
+		for _, result := range src.Status.Analysis.Metrics {
+			dst.Status.Analysis.Metrics = append(dst.Status.Analysis.Metrics, MetricResult{
+				Name:    result.Name,
+				Phase:   AnalysisPhase(result.Phase),
+				Value:   result.Value,
+				Message: result.Message,
+			})
+		}
+	}
+	for _, gate := range src.Status.Gates {
+		dst.Status.Gates = append(dst.Status.Gates, GateStatus{
+			Name:          gate.Name,
+			Revision:      gate.Revision,
+			Phase:         GatePhase(gate.Phase),
+			Message:       gate.Message,
+			LastCheckTime: gate.LastCheckTime,
+		})
+	}
+	for _, entry := range src.Status.RevisionHistory {
+		dst.Status.RevisionHistory = append(dst.Status.RevisionHistory, RevisionHistoryEntry(entry))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package v1beta1
+
+import (
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	hub := getHubPW()
+
+	spoke := &PartitionWorkload{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if *spoke.Spec.Strategy.Partition != *hub.Spec.Partition || !spoke.Spec.Strategy.Paused {
+		t.Errorf("strategy not converted from spec, got %+v", spoke.Spec.Strategy)
+	}
+	if spoke.Status.Replicas != hub.Status.Replicas {
+		t.Errorf("status.replicas = %d, want %d", spoke.Status.Replicas, hub.Status.Replicas)
+	}
+	if spoke.Status.Conditions[0].Type != PartitionWorkloadConditionFailedScale {
+		t.Errorf("condition type = %s, want %s", spoke.Status.Conditions[0].Type, PartitionWorkloadConditionFailedScale)
+	}
+
+	restored := &workloadv1alpha1.PartitionWorkload{}
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !apiequality.Semantic.DeepEqual(hub, restored) {
+		t.Errorf("hub -> v1beta1 -> hub is lossy:\nwant %+v\ngot  %+v", hub, restored)
+	}
+
+	again := &PartitionWorkload{}
+	if err := again.ConvertFrom(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !apiequality.Semantic.DeepEqual(spoke, again) {
+		t.Errorf("v1beta1 -> hub -> v1beta1 is lossy:\nwant %+v\ngot  %+v", spoke, again)
+	}
+}
+
+func TestConvertEmpty(t *testing.T) {
+	hub := &workloadv1alpha1.PartitionWorkload{ObjectMeta: metav1.ObjectMeta{Name: "empty"}}
+
+	spoke := &PartitionWorkload{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	restored := &workloadv1alpha1.PartitionWorkload{}
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !apiequality.Semantic.DeepEqual(hub, restored) {
+		t.Errorf("want %+v got %+v", hub, restored)
+	}
+}
+
+func getHubPW() *workloadv1alpha1.PartitionWorkload {
+	now := metav1.Now()
+	return &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   v1.NamespaceDefault,
+			Name:        "test-pw",
+			Labels:      map[string]string{"app": "test-app"},
+			Annotations: map[string]string{"foo": "bar"},
+			Generation:  3,
+		},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Replicas: ptr.To[int32](4),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test-app"}},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test-app"}},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "nginx", Image: "nginx:1.25"}}},
+			},
+			MinReadySeconds:      10,
+			RevisionHistoryLimit: ptr.To[int32](5),
+			RevisionHashIgnore: &workloadv1alpha1.RevisionHashIgnore{
+				Annotations: []string{"ci.example.com/build-id"},
+				Paths:       []string{"/spec/terminationGracePeriodSeconds"},
+			},
+			Partition:      ptr.To[int32](2),
+			Paused:         true,
+			PodNaming:      workloadv1alpha1.PodNamingOrdinal,
+			AdoptionPolicy: workloadv1alpha1.AdoptionPolicyIfRevisionMatches,
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+			},
+			PersistentVolumeClaimRetentionPolicy: &apps.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: apps.DeletePersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  apps.RetainPersistentVolumeClaimRetentionPolicyType,
+			},
+			CanaryOverrides: &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"track":"canary"}}}`)},
+			TrafficRouting: &workloadv1alpha1.TrafficRouting{
+				HTTPRoute:     "route",
+				StableService: "stable",
+				CanaryService: "canary",
+				CanaryWeight:  ptr.To[int32](10),
+			},
+			Analysis: &workloadv1alpha1.Analysis{
+				Address:       "http://prometheus:9090",
+				Interval:      &metav1.Duration{Duration: 30_000_000_000},
+				FailurePolicy: workloadv1alpha1.AnalysisFailurePolicyRollback,
+				Metrics: []workloadv1alpha1.AnalysisMetric{
+					{Name: "errors", Query: "errors", Max: ptr.To("0.05")},
+				},
+			},
+			Gates: []workloadv1alpha1.RolloutGate{{Name: "tests", URL: "https://tests.example"}},
+		},
+		Status: workloadv1alpha1.PartitionWorkloadStatus{
+			ObservedGeneration:   3,
+			Replicas:             4,
+			ReadyReplicas:        3,
+			AvailableReplicas:    3,
+			CurrentReplicas:      2,
+			UpdatedReplicas:      2,
+			UpdatedReadyReplicas: 1,
+			CurrentRevision:      "test-pw-1111",
+			UpdateRevision:       "test-pw-2222",
+			CollisionCount:       ptr.To[int32](1),
+			LabelSelector:        "app=test-app",
+			Conditions: []workloadv1alpha1.PartitionWorkloadCondition{{
+				Type:               workloadv1alpha1.PartitionWorkloadConditionFailedScale,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: 3,
+				LastUpdateTime:     now,
+				LastTransitionTime: now,
+				Reason:             workloadv1alpha1.ReasonFailedScale,
+				Message:            "quota exceeded",
+			}},
+			Analysis: &workloadv1alpha1.AnalysisStatus{
+				Revision:           "test-pw-2222",
+				Phase:              workloadv1alpha1.AnalysisPhaseSuccessful,
+				StartTime:          &now,
+				LastEvaluationTime: &now,
+				Metrics: []workloadv1alpha1.MetricResult{
+					{Name: "errors", Phase: workloadv1alpha1.AnalysisPhaseSuccessful, Value: "0.01"},
+				},
+			},
+			Gates: []workloadv1alpha1.GateStatus{{
+				Name:          "tests",
+				Revision:      "test-pw-2222",
+				Phase:         workloadv1alpha1.GatePhaseApproved,
+				Message:       "ok",
+				LastCheckTime: &now,
+			}},
+			RevisionHistory: []workloadv1alpha1.RevisionHistoryEntry{{
+				Name:           "test-pw-2222",
+				Revision:       2,
+				ChangeCause:    "kubectl set image",
+				CreationTime:   now,
+				CompletionTime: &now,
+				Replicas:       ptr.To[int32](4),
+			}},
+		},
+	}
+}
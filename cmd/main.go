@@ -36,10 +36,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	workloadv1beta1 "github.com/2170chm/k8s-partition-workload/api/v1beta1"
 	"github.com/2170chm/k8s-partition-workload/internal/controller"
+	analysis "github.com/2170chm/k8s-partition-workload/internal/controller/analysis"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/config"
+	gate "github.com/2170chm/k8s-partition-workload/internal/controller/gate"
+	migration "github.com/2170chm/k8s-partition-workload/internal/controller/migration"
 	"github.com/2170chm/k8s-partition-workload/internal/controller/revision"
 	status "github.com/2170chm/k8s-partition-workload/internal/controller/status"
 	sync "github.com/2170chm/k8s-partition-workload/internal/controller/sync"
+	traffic "github.com/2170chm/k8s-partition-workload/internal/controller/traffic"
 	history "github.com/2170chm/k8s-partition-workload/internal/util/history"
 	webhookv1alpha1 "github.com/2170chm/k8s-partition-workload/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
@@ -54,6 +60,8 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(workloadv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(workloadv1alpha1.AddToScheme(clientgoscheme.Scheme))
+	utilruntime.Must(workloadv1beta1.AddToScheme(scheme))
+	utilruntime.Must(workloadv1beta1.AddToScheme(clientgoscheme.Scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -66,6 +74,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var defaultHistoryLimit int
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -84,6 +93,8 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&defaultHistoryLimit, "default-revision-history-limit", config.DefaultHistoryLimit,
+		"The number of old ControllerRevisions kept for PartitionWorkloads that do not set spec.revisionHistoryLimit.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -92,6 +103,11 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if defaultHistoryLimit < 0 {
+		setupLog.Error(nil, "--default-revision-history-limit must not be negative", "value", defaultHistoryLimit)
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -190,12 +206,19 @@ func main() {
 	// }
 
 	if err := (&controller.PartitionWorkloadReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		HistoryControl:  history.NewHistory(mgr.GetClient()),
-		SyncControl:     sync.NewSync(mgr.GetClient()),
-		StatusUpdater:   status.NewStatusUpdater(mgr.GetClient()),
-		RevisionControl: revision.NewRevisionControl(mgr.GetClient(), mgr.GetScheme()),
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		HistoryControl:   history.NewHistory(mgr.GetClient()),
+		SyncControl:      sync.NewSync(mgr.GetClient()),
+		StatusUpdater:    status.NewStatusUpdater(mgr.GetClient()),
+		RevisionControl:  revision.NewRevisionControl(mgr.GetClient(), mgr.GetScheme()),
+		TrafficControl:   traffic.NewTrafficControl(mgr.GetClient()),
+		AnalysisControl:  analysis.NewAnalysisControl(),
+		GateControl:      gate.NewGateControl(),
+		MigrationControl: migration.NewMigrationControl(mgr.GetClient(), mgr.GetScheme()),
+		Recorder:         mgr.GetEventRecorder("partitionworkload-controller"),
+
+		DefaultHistoryLimit: int32(defaultHistoryLimit),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PartitionWorkload")
 		os.Exit(1)
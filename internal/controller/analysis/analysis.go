@@ -0,0 +1,242 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+const (
+	// DefaultInterval is used when spec.analysis.interval is not set
+	DefaultInterval = time.Minute
+
+	queryPath = "/api/v1/query"
+)
+
+// queryArgs are the values available to the go template of a metric query
+type queryArgs struct {
+	Name                string
+	Namespace           string
+	CurrentRevision     string
+	UpdateRevision      string
+	CurrentRevisionHash string
+	UpdateRevisionHash  string
+}
+
+// queryResponse is the subset of the Prometheus HTTP API response needed to read an instant query result
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type vectorSample struct {
+	Value []interface{} `json:"value"`
+}
+
+// Interval returns how often the metrics of the analysis are evaluated
+func Interval(analysis *workloadv1alpha1.Analysis) time.Duration {
+	if analysis.Interval == nil || analysis.Interval.Duration <= 0 {
+		return DefaultInterval
+	}
+	return analysis.Interval.Duration
+}
+
+// Analyze evaluates every metric of pw.Spec.Analysis against updateRevision and returns the result.
+// Metrics that can't be evaluated, e.g. because the endpoint is unreachable, are inconclusive rather
+// than failed so that a monitoring outage does not roll a workload back.
+//
+// Parameters:
+// - pw: PartitionWorkload whose spec.analysis is evaluated
+// - currentRevision: Name of the stable revision
+// - updateRevision: Name of the revision being analyzed
+//
+// Returns:
+// - the analysis status for updateRevision, timestamped now
+func (r *realAnalysis) Analyze(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string) *workloadv1alpha1.AnalysisStatus {
+	now := metav1.Now()
+	status := &workloadv1alpha1.AnalysisStatus{
+		Revision:           updateRevision,
+		Phase:              workloadv1alpha1.AnalysisPhaseSuccessful,
+		LastEvaluationTime: &now,
+	}
+	args := queryArgs{
+		Name:                pw.Name,
+		Namespace:           pw.Namespace,
+		CurrentRevision:     currentRevision,
+		UpdateRevision:      updateRevision,
+		CurrentRevisionHash: generalutil.GetShortHash(currentRevision),
+		UpdateRevisionHash:  generalutil.GetShortHash(updateRevision),
+	}
+
+	for _, metric := range pw.Spec.Analysis.Metrics {
+		result := r.evaluateMetric(pw.Spec.Analysis.Address, metric, args)
+		status.Metrics = append(status.Metrics, result)
+		switch result.Phase {
+		case workloadv1alpha1.AnalysisPhaseFailed:
+			status.Phase = workloadv1alpha1.AnalysisPhaseFailed
+		case workloadv1alpha1.AnalysisPhaseInconclusive:
+			if status.Phase != workloadv1alpha1.AnalysisPhaseFailed {
+				status.Phase = workloadv1alpha1.AnalysisPhaseInconclusive
+			}
+		}
+	}
+
+	klog.InfoS("---- analysis update ----")
+	klog.InfoS("Evaluated analysis metrics", "PartitionWorkload", klog.KObj(pw), "revision", updateRevision,
+		"phase", status.Phase, "metrics", generalutil.DumpJSON(status.Metrics))
+	return status
+}
+
+func (r *realAnalysis) evaluateMetric(address string, metric workloadv1alpha1.AnalysisMetric, args queryArgs) workloadv1alpha1.MetricResult {
+	result := workloadv1alpha1.MetricResult{Name: metric.Name}
+
+	query, err := renderQuery(metric.Query, args)
+	if err != nil {
+		result.Phase = workloadv1alpha1.AnalysisPhaseInconclusive
+		result.Message = err.Error()
+		return result
+	}
+
+	value, err := r.query(address, query)
+	if err != nil {
+		result.Phase = workloadv1alpha1.AnalysisPhaseInconclusive
+		result.Message = err.Error()
+		return result
+	}
+	result.Value = strconv.FormatFloat(value, 'f', -1, 64)
+
+	passed, err := inRange(value, metric.Min, metric.Max)
+	if err != nil {
+		result.Phase = workloadv1alpha1.AnalysisPhaseInconclusive
+		result.Message = err.Error()
+		return result
+	}
+	if !passed {
+		result.Phase = workloadv1alpha1.AnalysisPhaseFailed
+		result.Message = fmt.Sprintf("value %s is out of range [%s, %s]", result.Value, rangeBound(metric.Min, "-inf"), rangeBound(metric.Max, "+inf"))
+		return result
+	}
+	result.Phase = workloadv1alpha1.AnalysisPhaseSuccessful
+	return result
+}
+
+// ValidateQuery returns an error if the query template doesn't parse or references fields it can't be rendered with
+func ValidateQuery(query string) error {
+	_, err := renderQuery(query, queryArgs{})
+	return err
+}
+
+func renderQuery(query string, args queryArgs) (string, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, args); err != nil {
+		return "", fmt.Errorf("invalid query template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// query runs an instant query and returns its value. The result must be a scalar or a vector with exactly one sample.
+func (r *realAnalysis) query(address, query string) (float64, error) {
+	endpoint := strings.TrimSuffix(address, "/") + queryPath + "?" + url.Values{"query": []string{query}}.Encode()
+	resp, err := r.httpClient.Get(endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("query failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read query response: %v", err)
+	}
+	var parsed queryResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return 0, fmt.Errorf("failed to decode query response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || parsed.Status != "success" {
+		return 0, fmt.Errorf("query failed (HTTP %d): %s", resp.StatusCode, parsed.Error)
+	}
+
+	var sample []interface{}
+	switch parsed.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(parsed.Data.Result, &sample); err != nil {
+			return 0, fmt.Errorf("failed to decode scalar result: %v", err)
+		}
+	case "vector":
+		var vector []vectorSample
+		if err := json.Unmarshal(parsed.Data.Result, &vector); err != nil {
+			return 0, fmt.Errorf("failed to decode vector result: %v", err)
+		}
+		if len(vector) != 1 {
+			return 0, fmt.Errorf("query returned %d samples, expected 1", len(vector))
+		}
+		sample = vector[0].Value
+	default:
+		return 0, fmt.Errorf("unsupported result type %q", parsed.Data.ResultType)
+	}
+
+	// Samples are [<unix time>, "<value>"]
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("malformed sample %v", sample)
+	}
+	str, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("malformed sample value %v", sample[1])
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+// inRange returns whether value lies within the bounds. NaN and infinite values, which Prometheus returns e.g. for
+// ratios over no samples, are an error so that they do not pass an open-ended range.
+func inRange(value float64, min, max *string) (bool, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return false, fmt.Errorf("value %s is not a finite number", strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	if min != nil {
+		bound, err := strconv.ParseFloat(*min, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid min %q: %v", *min, err)
+		}
+		if value < bound {
+			return false, nil
+		}
+	}
+	if max != nil {
+		bound, err := strconv.ParseFloat(*max, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid max %q: %v", *max, err)
+		}
+		if value > bound {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func rangeBound(bound *string, unset string) string {
+	if bound == nil {
+		return unset
+	}
+	return *bound
+}
@@ -0,0 +1,173 @@
+package analysis
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+const (
+	testPWName      = "test-pw"
+	currentRevision = "test-pw-1111"
+	updateRevision  = "test-pw-2222"
+)
+
+// newPrometheus starts a stand-in for the Prometheus HTTP API that answers each query with the response
+// registered for it, and fails queries it does not know.
+func newPrometheus(t *testing.T, responses map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != queryPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp, ok := responses[req.URL.Query().Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"unknown query"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func vector(value string) string {
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"%s"]}]}}`, value)
+}
+
+func scalar(value string) string {
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"%s"]}}`, value)
+}
+
+func TestAnalyze(t *testing.T) {
+	server := newPrometheus(t, map[string]string{
+		`error_rate{pod_template_hash="2222"}`: vector("0.01"),
+		`latency{namespace="default"}`:         scalar("350"),
+		`empty`:                                `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		`nan`:                                  vector("NaN"),
+		`inf`:                                  scalar("+Inf"),
+	})
+
+	tests := []struct {
+		name           string
+		metrics        []workloadv1alpha1.AnalysisMetric
+		expectedPhase  workloadv1alpha1.AnalysisPhase
+		expectedValues []string
+	}{
+		{
+			name: "All metrics pass",
+			metrics: []workloadv1alpha1.AnalysisMetric{
+				{Name: "errors", Query: `error_rate{pod_template_hash="{{ .UpdateRevisionHash }}"}`, Max: strPtr("0.05")},
+				{Name: "latency", Query: `latency{namespace="{{ .Namespace }}"}`, Min: strPtr("100"), Max: strPtr("500")},
+			},
+			expectedPhase:  workloadv1alpha1.AnalysisPhaseSuccessful,
+			expectedValues: []string{"0.01", "350"},
+		},
+		{
+			name: "One metric out of range fails the analysis",
+			metrics: []workloadv1alpha1.AnalysisMetric{
+				{Name: "errors", Query: `error_rate{pod_template_hash="{{ .UpdateRevisionHash }}"}`, Max: strPtr("0.05")},
+				{Name: "latency", Query: `latency{namespace="{{ .Namespace }}"}`, Max: strPtr("200")},
+			},
+			expectedPhase:  workloadv1alpha1.AnalysisPhaseFailed,
+			expectedValues: []string{"0.01", "350"},
+		},
+		{
+			name: "Query errors are inconclusive",
+			metrics: []workloadv1alpha1.AnalysisMetric{
+				{Name: "errors", Query: `error_rate{pod_template_hash="{{ .UpdateRevisionHash }}"}`, Max: strPtr("0.05")},
+				{Name: "unknown", Query: `unknown`, Max: strPtr("1")},
+			},
+			expectedPhase:  workloadv1alpha1.AnalysisPhaseInconclusive,
+			expectedValues: []string{"0.01", ""},
+		},
+		{
+			name: "Empty results are inconclusive",
+			metrics: []workloadv1alpha1.AnalysisMetric{
+				{Name: "empty", Query: `empty`, Max: strPtr("1")},
+			},
+			expectedPhase:  workloadv1alpha1.AnalysisPhaseInconclusive,
+			expectedValues: []string{""},
+		},
+		{
+			name: "NaN and infinite values are inconclusive",
+			metrics: []workloadv1alpha1.AnalysisMetric{
+				{Name: "nan", Query: `nan`, Max: strPtr("1")},
+				{Name: "inf", Query: `inf`, Min: strPtr("100")},
+			},
+			expectedPhase:  workloadv1alpha1.AnalysisPhaseInconclusive,
+			expectedValues: []string{"NaN", "+Inf"},
+		},
+		{
+			name: "Failures take precedence over inconclusive metrics",
+			metrics: []workloadv1alpha1.AnalysisMetric{
+				{Name: "unknown", Query: `unknown`, Max: strPtr("1")},
+				{Name: "latency", Query: `latency{namespace="{{ .Namespace }}"}`, Max: strPtr("200")},
+			},
+			expectedPhase:  workloadv1alpha1.AnalysisPhaseFailed,
+			expectedValues: []string{"", "350"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw := getPW(server.URL, tt.metrics)
+			r := NewAnalysisControl()
+
+			status := r.Analyze(pw, currentRevision, updateRevision)
+			if status.Revision != updateRevision {
+				t.Errorf("Revision = %s, want %s", status.Revision, updateRevision)
+			}
+			if status.LastEvaluationTime == nil {
+				t.Errorf("LastEvaluationTime is not set")
+			}
+			if status.Phase != tt.expectedPhase {
+				t.Errorf("Phase = %s, want %s, metrics %v", status.Phase, tt.expectedPhase, status.Metrics)
+			}
+			if len(status.Metrics) != len(tt.expectedValues) {
+				t.Fatalf("got %d metric results, want %d", len(status.Metrics), len(tt.expectedValues))
+			}
+			for i, value := range tt.expectedValues {
+				if status.Metrics[i].Value != value {
+					t.Errorf("metric %s value = %q, want %q", status.Metrics[i].Name, status.Metrics[i].Value, value)
+				}
+			}
+		})
+	}
+}
+
+func TestInterval(t *testing.T) {
+	if got := Interval(&workloadv1alpha1.Analysis{}); got != DefaultInterval {
+		t.Errorf("Interval() = %v, want %v", got, DefaultInterval)
+	}
+	analysis := &workloadv1alpha1.Analysis{Interval: &metav1.Duration{Duration: 30_000_000_000}}
+	if got := Interval(analysis); got != analysis.Interval.Duration {
+		t.Errorf("Interval() = %v, want %v", got, analysis.Interval.Duration)
+	}
+}
+
+func getPW(address string, metrics []workloadv1alpha1.AnalysisMetric) *workloadv1alpha1.PartitionWorkload {
+	return &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: v1.NamespaceDefault,
+			Name:      testPWName,
+		},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Analysis: &workloadv1alpha1.Analysis{
+				Address: address,
+				Metrics: metrics,
+			},
+		},
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
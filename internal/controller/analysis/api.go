@@ -0,0 +1,27 @@
+package analysis
+
+import (
+	"net/http"
+	"time"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+const (
+	// defaultQueryTimeout bounds a single metric query so that a slow endpoint does not block reconciles
+	defaultQueryTimeout = 10 * time.Second
+)
+
+type Interface interface {
+	Analyze(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string) *workloadv1alpha1.AnalysisStatus
+}
+
+type realAnalysis struct {
+	httpClient *http.Client
+}
+
+func NewAnalysisControl() Interface {
+	return &realAnalysis{
+		httpClient: &http.Client{Timeout: defaultQueryTimeout},
+	}
+}
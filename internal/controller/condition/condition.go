@@ -1,42 +1,72 @@
 package condition
 
 import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
 )
 
+// SetCondition adds or updates the condition of its type in status. LastTransitionTime is only moved when the
+// status of the condition changes, and is set to now if the new condition does not carry one. LastUpdateTime is
+// moved whenever the condition changes.
 func SetCondition(status *workloadv1alpha1.PartitionWorkloadStatus, condition workloadv1alpha1.PartitionWorkloadCondition) {
-	currentCond := GetCondition(*status, condition.Type)
-	if currentCond != nil && currentCond.Status == condition.Status && currentCond.Reason == condition.Reason {
-		return
+	now := metav1.NewTime(time.Now())
+	if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = now
+	}
+	if condition.LastUpdateTime.IsZero() {
+		condition.LastUpdateTime = now
 	}
 
-	if currentCond != nil && currentCond.Status == condition.Status {
-		condition.LastTransitionTime = currentCond.LastTransitionTime
+	existing := findCondition(status.Conditions, condition.Type)
+	if existing == nil {
+		status.Conditions = append(status.Conditions, condition)
+		return
+	}
+	if existing.Status == condition.Status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+		if existing.Reason == condition.Reason && existing.Message == condition.Message &&
+			existing.ObservedGeneration == condition.ObservedGeneration {
+			condition.LastUpdateTime = existing.LastUpdateTime
+		}
 	}
+	*existing = condition
+}
 
-	newConditions := filterOutCondition(status.Conditions, condition.Type)
-	status.Conditions = append(newConditions, condition)
+// GetCondition returns the condition of the given type in status, or nil if there is none.
+func GetCondition(status workloadv1alpha1.PartitionWorkloadStatus, condType string) *workloadv1alpha1.PartitionWorkloadCondition {
+	return findCondition(status.Conditions, condType)
 }
 
-func GetCondition(status workloadv1alpha1.PartitionWorkloadStatus, condType workloadv1alpha1.PartitionWorkloadConditionType) *workloadv1alpha1.PartitionWorkloadCondition {
-	for i := range status.Conditions {
-		c := status.Conditions[i]
-		if c.Type == condType {
-			return &c
+// RemoveCondition removes the condition of the given type from status, if any.
+func RemoveCondition(status *workloadv1alpha1.PartitionWorkloadStatus, condType string) {
+	var conditions []workloadv1alpha1.PartitionWorkloadCondition
+	for _, c := range status.Conditions {
+		if c.Type != condType {
+			conditions = append(conditions, c)
 		}
 	}
-	return nil
+	status.Conditions = conditions
 }
 
-func filterOutCondition(conditions []workloadv1alpha1.PartitionWorkloadCondition, condType workloadv1alpha1.PartitionWorkloadConditionType) []workloadv1alpha1.PartitionWorkloadCondition {
-	var newConditions []workloadv1alpha1.PartitionWorkloadCondition
+// NewCondition returns a condition observed at the given generation of the PartitionWorkload.
+func NewCondition(condType string, status metav1.ConditionStatus, generation int64, reason, message string) workloadv1alpha1.PartitionWorkloadCondition {
+	return workloadv1alpha1.PartitionWorkloadCondition{
+		Type:               condType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	}
+}
 
-	for _, c := range conditions {
-		if c.Type == condType {
-			continue
+func findCondition(conditions []workloadv1alpha1.PartitionWorkloadCondition, condType string) *workloadv1alpha1.PartitionWorkloadCondition {
+	for i := range conditions {
+		if conditions[i].Type == condType {
+			return &conditions[i]
 		}
-		newConditions = append(newConditions, c)
 	}
-
-	return newConditions
+	return nil
 }
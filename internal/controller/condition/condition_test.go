@@ -4,25 +4,24 @@ import (
 	"testing"
 	"time"
 
-	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
 )
 
 func TestGetPartitionWorkloadCondition(t *testing.T) {
-	condType := workloadv1alpha1.PartionWorkloadConditionFailedScale
+	condType := workloadv1alpha1.PartitionWorkloadConditionFailedScale
 	condition := workloadv1alpha1.PartitionWorkloadCondition{
 		Type:   condType,
-		Status: v1.ConditionTrue,
+		Status: metav1.ConditionTrue,
 	}
 
 	tests := []struct {
 		name       string
 		status     workloadv1alpha1.PartitionWorkloadStatus
-		condType   workloadv1alpha1.PartitionWorkloadConditionType
+		condType   string
 		wantExist  bool
-		wantStatus v1.ConditionStatus
+		wantStatus metav1.ConditionStatus
 	}{
 		{
 			name: "Condition exists",
@@ -31,7 +30,7 @@ func TestGetPartitionWorkloadCondition(t *testing.T) {
 			},
 			condType:   condType,
 			wantExist:  true,
-			wantStatus: v1.ConditionTrue,
+			wantStatus: metav1.ConditionTrue,
 		},
 		{
 			name: "Condition not exists",
@@ -59,19 +58,15 @@ func TestGetPartitionWorkloadCondition(t *testing.T) {
 	}
 }
 
-func getNewCondition(condType workloadv1alpha1.PartitionWorkloadConditionType, status v1.ConditionStatus,
-	now time.Time) *workloadv1alpha1.PartitionWorkloadCondition {
-	return &workloadv1alpha1.PartitionWorkloadCondition{
-		Type:               condType,
-		Status:             status,
-		LastUpdateTime:     metav1.NewTime(now),
-		LastTransitionTime: metav1.NewTime(now),
-	}
+func getNewCondition(condType string, status metav1.ConditionStatus, generation int64, now time.Time) *workloadv1alpha1.PartitionWorkloadCondition {
+	cond := NewCondition(condType, status, generation, workloadv1alpha1.ReasonFailedScale, "")
+	cond.LastTransitionTime = metav1.NewTime(now)
+	return &cond
 }
 
 func TestSetPartitionWorkloadCondition(t *testing.T) {
 	now := time.Now()
-	condType := workloadv1alpha1.PartionWorkloadConditionFailedScale
+	condType := workloadv1alpha1.PartitionWorkloadConditionFailedScale
 
 	tests := []struct {
 		name           string
@@ -85,19 +80,19 @@ func TestSetPartitionWorkloadCondition(t *testing.T) {
 				Conditions: []workloadv1alpha1.PartitionWorkloadCondition{
 					{
 						Type:               condType,
-						Status:             v1.ConditionTrue,
-						LastUpdateTime:     metav1.NewTime(now.Add(-time.Minute)),
+						Status:             metav1.ConditionTrue,
+						ObservedGeneration: 1,
 						LastTransitionTime: metav1.NewTime(now.Add(-time.Minute)),
 					},
 				},
 			},
-			newCondition: getNewCondition(condType, v1.ConditionFalse, now.Add(time.Second)),
+			newCondition: getNewCondition(condType, metav1.ConditionFalse, 2, now.Add(time.Second)),
 			expectedStatus: workloadv1alpha1.PartitionWorkloadStatus{
 				Conditions: []workloadv1alpha1.PartitionWorkloadCondition{
 					{
 						Type:               condType,
-						Status:             v1.ConditionFalse,
-						LastUpdateTime:     metav1.NewTime(now.Add(time.Second)),
+						Status:             metav1.ConditionFalse,
+						ObservedGeneration: 2,
 						LastTransitionTime: metav1.NewTime(now.Add(time.Second)),
 					},
 				},
@@ -109,24 +104,39 @@ func TestSetPartitionWorkloadCondition(t *testing.T) {
 				Conditions: []workloadv1alpha1.PartitionWorkloadCondition{
 					{
 						Type:               condType,
-						Status:             v1.ConditionTrue,
-						LastUpdateTime:     metav1.NewTime(now.Add(-time.Minute)),
+						Status:             metav1.ConditionTrue,
+						ObservedGeneration: 1,
 						LastTransitionTime: metav1.NewTime(now.Add(-time.Minute)),
 					},
 				},
 			},
-			newCondition: getNewCondition(condType, v1.ConditionTrue, now.Add(time.Second)),
+			newCondition: getNewCondition(condType, metav1.ConditionTrue, 2, now.Add(time.Second)),
 			expectedStatus: workloadv1alpha1.PartitionWorkloadStatus{
 				Conditions: []workloadv1alpha1.PartitionWorkloadCondition{
 					{
 						Type:               condType,
-						Status:             v1.ConditionTrue,
-						LastUpdateTime:     metav1.NewTime(now.Add(time.Second)),
+						Status:             metav1.ConditionTrue,
+						ObservedGeneration: 2,
 						LastTransitionTime: metav1.NewTime(now.Add(-time.Minute)),
 					},
 				},
 			},
 		},
+		{
+			name:          "Add a new condition",
+			initialStatus: workloadv1alpha1.PartitionWorkloadStatus{},
+			newCondition:  getNewCondition(condType, metav1.ConditionTrue, 1, now),
+			expectedStatus: workloadv1alpha1.PartitionWorkloadStatus{
+				Conditions: []workloadv1alpha1.PartitionWorkloadCondition{
+					{
+						Type:               condType,
+						Status:             metav1.ConditionTrue,
+						ObservedGeneration: 1,
+						LastTransitionTime: metav1.NewTime(now),
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -138,10 +148,27 @@ func TestSetPartitionWorkloadCondition(t *testing.T) {
 			if len(tt.initialStatus.Conditions) > 0 {
 				got := tt.initialStatus.Conditions[0]
 				want := tt.expectedStatus.Conditions[0]
-				if got.Type != want.Type || got.Status != want.Status {
+				if got.Type != want.Type || got.Status != want.Status || got.ObservedGeneration != want.ObservedGeneration ||
+					!got.LastTransitionTime.Equal(&want.LastTransitionTime) {
 					t.Errorf("Condition mismatch: got %+v, want %+v", got, want)
 				}
 			}
 		})
 	}
 }
+
+func TestRemovePartitionWorkloadCondition(t *testing.T) {
+	status := workloadv1alpha1.PartitionWorkloadStatus{
+		Conditions: []workloadv1alpha1.PartitionWorkloadCondition{
+			{Type: workloadv1alpha1.PartitionWorkloadConditionFailedScale, Status: metav1.ConditionTrue},
+			{Type: workloadv1alpha1.PartitionWorkloadConditionAvailable, Status: metav1.ConditionTrue},
+		},
+	}
+	RemoveCondition(&status, workloadv1alpha1.PartitionWorkloadConditionFailedScale)
+	if GetCondition(status, workloadv1alpha1.PartitionWorkloadConditionFailedScale) != nil {
+		t.Errorf("FailedScale was not removed")
+	}
+	if GetCondition(status, workloadv1alpha1.PartitionWorkloadConditionAvailable) == nil {
+		t.Errorf("Available was removed")
+	}
+}
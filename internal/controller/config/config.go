@@ -1,9 +1,20 @@
 package config
 
+import "time"
+
 const (
 	// Note that the historySize is the max number of non-live revisions allowed
 	// A live revision is a revision that is either being used by at least one
 	// pod or is the updaterevision or the currenrevision of PartitionWorkload
 	// It does not represent the total number of controllerrevisions
+	// It applies to PartitionWorkloads without spec.revisionHistoryLimit and can be overridden with the
+	// --default-revision-history-limit flag
 	DefaultHistoryLimit = 10
+
+	// MigrationPollInterval is how often a migrating PartitionWorkload checks whether the Deployment it migrates
+	// from has scaled down
+	MigrationPollInterval = 5 * time.Second
+
+	// RevisionCacheSize is the number of pod templates decoded from ControllerRevisions that are kept in memory
+	RevisionCacheSize = 1024
 )
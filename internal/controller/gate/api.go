@@ -0,0 +1,42 @@
+package gate
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+const (
+	// defaultRequestTimeout bounds a single gate call so that a slow endpoint does not block reconciles
+	defaultRequestTimeout = 10 * time.Second
+	// initialBackoff is the delay before a gate that held the rollout or could not be reached is called again
+	initialBackoff = 5 * time.Second
+	// maxBackoff caps the exponential backoff between calls to the same gate
+	maxBackoff = 5 * time.Minute
+)
+
+type Interface interface {
+	Evaluate(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string, pods []*v1.Pod) ([]workloadv1alpha1.GateStatus, time.Duration)
+}
+
+type realGate struct {
+	httpClient *http.Client
+	clock      clock.Clock
+
+	// mu guards cache, which is shared by concurrent reconciles
+	mu    sync.Mutex
+	cache map[cacheKey]*cacheEntry
+}
+
+func NewGateControl() Interface {
+	return &realGate{
+		httpClient: &http.Client{Timeout: defaultRequestTimeout},
+		clock:      clock.RealClock{},
+		cache:      map[cacheKey]*cacheEntry{},
+	}
+}
@@ -0,0 +1,252 @@
+package gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+const (
+	// cacheTTL is how long an answer is kept after the gate was last called. It is longer than maxBackoff, so
+	// only entries of finished rollouts and deleted PartitionWorkloads expire. Approvals outlive the cache in status.
+	cacheTTL = time.Hour
+	// maxMessageLength bounds the message recorded in status
+	maxMessageLength = 256
+)
+
+// payload is the JSON body POSTed to a gate
+type payload struct {
+	Name                 string    `json:"name"`
+	Namespace            string    `json:"namespace"`
+	UID                  types.UID `json:"uid"`
+	Gate                 string    `json:"gate"`
+	CurrentRevision      string    `json:"currentRevision"`
+	UpdateRevision       string    `json:"updateRevision"`
+	Replicas             int32     `json:"replicas"`
+	Partition            int32     `json:"partition"`
+	UpdatedReplicas      int32     `json:"updatedReplicas"`
+	ReadyReplicas        int32     `json:"readyReplicas"`
+	CurrentReadyReplicas int32     `json:"currentReadyReplicas"`
+	UpdatedReadyReplicas int32     `json:"updatedReadyReplicas"`
+}
+
+// response is the JSON body a gate answers with
+type response struct {
+	Advance bool   `json:"advance"`
+	Message string `json:"message,omitempty"`
+}
+
+type cacheKey struct {
+	uid      types.UID
+	revision string
+	name     string
+	url      string
+}
+
+type cacheEntry struct {
+	status    workloadv1alpha1.GateStatus
+	failures  int
+	nextCheck time.Time
+}
+
+// Evaluate asks every gate in pw.Spec.Gates whether the rollout to updateRevision may advance.
+// A gate is only called again once its backoff has elapsed, and never again for a revision it approved.
+//
+// Parameters:
+// - pw: PartitionWorkload whose spec.gates are evaluated
+// - currentRevision: Name of the stable revision
+// - updateRevision: Name of the revision being rolled out
+// - pods: All active pods owned by this PartitionWorkload
+//
+// Returns:
+// - the status of each gate, in spec order
+// - how long to wait until the next gate call is due, or 0 if every gate approved
+func (r *realGate) Evaluate(
+	pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string, pods []*v1.Pod,
+) ([]workloadv1alpha1.GateStatus, time.Duration) {
+	r.prune()
+	if len(pw.Spec.Gates) == 0 {
+		return nil, 0
+	}
+
+	body := newPayload(pw, currentRevision, updateRevision, pods)
+	var statuses []workloadv1alpha1.GateStatus
+	var requeueAfter time.Duration
+	for _, gate := range pw.Spec.Gates {
+		key := cacheKey{uid: pw.UID, revision: updateRevision, name: gate.Name, url: gate.URL}
+		entry := r.lookup(key, pw.Status.Gates)
+
+		now := r.clock.Now()
+		if entry == nil || (entry.status.Phase != workloadv1alpha1.GatePhaseApproved && !now.Before(entry.nextCheck)) {
+			body.Gate = gate.Name
+			entry = r.check(key, entry, gate, body)
+		}
+		statuses = append(statuses, entry.status)
+
+		if entry.status.Phase != workloadv1alpha1.GatePhaseApproved {
+			if wait := entry.nextCheck.Sub(now); requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = max(wait, time.Second)
+			}
+		}
+	}
+
+	klog.InfoS("---- gate update ----")
+	klog.InfoS("Evaluated rollout gates", "PartitionWorkload", klog.KObj(pw), "revision", updateRevision,
+		"gates", generalutil.DumpJSON(statuses))
+	return statuses, requeueAfter
+}
+
+// lookup returns the cached answer for key. An approval recorded in status counts as cached so that gates
+// are not asked again after the controller restarts.
+func (r *realGate) lookup(key cacheKey, recorded []workloadv1alpha1.GateStatus) *cacheEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.cache[key]; ok {
+		return entry
+	}
+	for _, status := range recorded {
+		if status.Name == key.name && status.Revision == key.revision && status.Phase == workloadv1alpha1.GatePhaseApproved {
+			entry := &cacheEntry{status: status, nextCheck: r.clock.Now()}
+			r.cache[key] = entry
+			return entry
+		}
+	}
+	return nil
+}
+
+// check calls the gate and caches its answer. Holds and failures push the next call back exponentially.
+func (r *realGate) check(key cacheKey, previous *cacheEntry, gate workloadv1alpha1.RolloutGate, body payload) *cacheEntry {
+	resp, err := r.call(gate.URL, body)
+
+	now := r.clock.Now()
+	checkTime := metav1.NewTime(now)
+	entry := &cacheEntry{
+		status: workloadv1alpha1.GateStatus{
+			Name:          gate.Name,
+			Revision:      key.revision,
+			LastCheckTime: &checkTime,
+		},
+		nextCheck: now,
+	}
+	switch {
+	case err != nil:
+		entry.status.Phase = workloadv1alpha1.GatePhasePending
+		entry.status.Message = truncate(err.Error())
+	case resp.Advance:
+		entry.status.Phase = workloadv1alpha1.GatePhaseApproved
+		entry.status.Message = truncate(resp.Message)
+	default:
+		entry.status.Phase = workloadv1alpha1.GatePhaseHeld
+		entry.status.Message = truncate(resp.Message)
+	}
+	if entry.status.Phase != workloadv1alpha1.GatePhaseApproved {
+		if previous != nil {
+			entry.failures = previous.failures
+		}
+		entry.nextCheck = now.Add(backoff(entry.failures))
+		entry.failures++
+	}
+
+	r.mu.Lock()
+	r.cache[key] = entry
+	r.mu.Unlock()
+	return entry
+}
+
+func (r *realGate) call(url string, body payload) (*response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gate call failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gate response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gate returned HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	var parsed response
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode gate response: %v", err)
+	}
+	return &parsed, nil
+}
+
+// prune drops answers that have not been refreshed within cacheTTL
+func (r *realGate) prune() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	for key, entry := range r.cache {
+		if entry.status.LastCheckTime == nil || now.Sub(entry.status.LastCheckTime.Time) > cacheTTL {
+			delete(r.cache, key)
+		}
+	}
+}
+
+func newPayload(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string, pods []*v1.Pod) payload {
+	body := payload{
+		Name:            pw.Name,
+		Namespace:       pw.Namespace,
+		UID:             pw.UID,
+		CurrentRevision: currentRevision,
+		UpdateRevision:  updateRevision,
+	}
+	if pw.Spec.Replicas != nil {
+		body.Replicas = *pw.Spec.Replicas
+	}
+	body.Partition = body.Replicas
+	if pw.Spec.Partition != nil && *pw.Spec.Partition < body.Replicas {
+		body.Partition = *pw.Spec.Partition
+	}
+	for _, pod := range pods {
+		updated := generalutil.EqualToRevisionHash(pod, updateRevision)
+		if updated {
+			body.UpdatedReplicas++
+		}
+		if !podutil.IsPodReady(pod) {
+			continue
+		}
+		body.ReadyReplicas++
+		if updated {
+			body.UpdatedReadyReplicas++
+		} else if generalutil.EqualToRevisionHash(pod, currentRevision) {
+			body.CurrentReadyReplicas++
+		}
+	}
+	return body
+}
+
+// backoff returns initialBackoff doubled for every previous failure, capped at maxBackoff
+func backoff(failures int) time.Duration {
+	d := initialBackoff
+	for i := 0; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+func truncate(message string) string {
+	if len(message) > maxMessageLength {
+		return message[:maxMessageLength]
+	}
+	return message
+}
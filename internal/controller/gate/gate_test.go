@@ -0,0 +1,249 @@
+package gate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+const (
+	testPWName      = "test-pw"
+	currentRevision = "test-pw-1111"
+	updateRevision  = "test-pw-2222"
+)
+
+// gateServer is a stand-in gate endpoint that records the payloads it receives
+type gateServer struct {
+	*httptest.Server
+	status   int
+	response response
+	payloads []payload
+}
+
+func newGateServer(t *testing.T, status int, resp response) *gateServer {
+	s := &gateServer{status: status, response: resp}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body payload
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.payloads = append(s.payloads, body)
+		w.WriteHeader(s.status)
+		_ = json.NewEncoder(w).Encode(s.response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newFakeGate(now time.Time) (*realGate, *testingclock.FakeClock) {
+	fakeClock := testingclock.NewFakeClock(now)
+	return &realGate{
+		httpClient: &http.Client{Timeout: time.Second},
+		clock:      fakeClock,
+		cache:      map[cacheKey]*cacheEntry{},
+	}, fakeClock
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		response        response
+		expectedPhase   workloadv1alpha1.GatePhase
+		expectedMessage string
+		expectRequeue   bool
+	}{
+		{
+			name:            "Gate approves",
+			status:          http.StatusOK,
+			response:        response{Advance: true, Message: "tests passed"},
+			expectedPhase:   workloadv1alpha1.GatePhaseApproved,
+			expectedMessage: "tests passed",
+		},
+		{
+			name:            "Gate holds",
+			status:          http.StatusOK,
+			response:        response{Advance: false, Message: "waiting for approval"},
+			expectedPhase:   workloadv1alpha1.GatePhaseHeld,
+			expectedMessage: "waiting for approval",
+			expectRequeue:   true,
+		},
+		{
+			name:          "Gate errors",
+			status:        http.StatusInternalServerError,
+			response:      response{Advance: true},
+			expectedPhase: workloadv1alpha1.GatePhasePending,
+			expectRequeue: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGateServer(t, tt.status, tt.response)
+			r, _ := newFakeGate(time.Now())
+			pw := getPW(server.URL)
+
+			statuses, requeueAfter := r.Evaluate(pw, currentRevision, updateRevision, getPods())
+			if len(statuses) != 1 {
+				t.Fatalf("got %d gate statuses, want 1", len(statuses))
+			}
+			if statuses[0].Phase != tt.expectedPhase {
+				t.Errorf("phase = %s, want %s (%s)", statuses[0].Phase, tt.expectedPhase, statuses[0].Message)
+			}
+			if tt.expectedMessage != "" && statuses[0].Message != tt.expectedMessage {
+				t.Errorf("message = %q, want %q", statuses[0].Message, tt.expectedMessage)
+			}
+			if (requeueAfter > 0) != tt.expectRequeue {
+				t.Errorf("requeueAfter = %v, expect requeue %v", requeueAfter, tt.expectRequeue)
+			}
+		})
+	}
+}
+
+func TestEvaluatePayload(t *testing.T) {
+	server := newGateServer(t, http.StatusOK, response{Advance: true})
+	r, _ := newFakeGate(time.Now())
+	pw := getPW(server.URL)
+
+	r.Evaluate(pw, currentRevision, updateRevision, getPods())
+	if len(server.payloads) != 1 {
+		t.Fatalf("gate called %d times, want 1", len(server.payloads))
+	}
+	expected := payload{
+		Name:                 testPWName,
+		Namespace:            v1.NamespaceDefault,
+		UID:                  pw.UID,
+		Gate:                 "tests",
+		CurrentRevision:      currentRevision,
+		UpdateRevision:       updateRevision,
+		Replicas:             4,
+		Partition:            2,
+		UpdatedReplicas:      2,
+		ReadyReplicas:        3,
+		CurrentReadyReplicas: 2,
+		UpdatedReadyReplicas: 1,
+	}
+	if server.payloads[0] != expected {
+		t.Errorf("payload = %+v, want %+v", server.payloads[0], expected)
+	}
+}
+
+func TestEvaluateCache(t *testing.T) {
+	server := newGateServer(t, http.StatusOK, response{Advance: false})
+	r, fakeClock := newFakeGate(time.Now())
+	pw := getPW(server.URL)
+	pods := getPods()
+
+	// Held answers are only asked again after the backoff, which doubles every time
+	r.Evaluate(pw, currentRevision, updateRevision, pods)
+	r.Evaluate(pw, currentRevision, updateRevision, pods)
+	if len(server.payloads) != 1 {
+		t.Fatalf("gate called %d times before backoff elapsed, want 1", len(server.payloads))
+	}
+	fakeClock.Step(initialBackoff)
+	_, requeueAfter := r.Evaluate(pw, currentRevision, updateRevision, pods)
+	if len(server.payloads) != 2 {
+		t.Fatalf("gate called %d times after backoff elapsed, want 2", len(server.payloads))
+	}
+	if requeueAfter != 2*initialBackoff {
+		t.Errorf("requeueAfter = %v, want %v", requeueAfter, 2*initialBackoff)
+	}
+
+	// Approvals are final for the revision
+	server.response = response{Advance: true}
+	fakeClock.Step(2 * initialBackoff)
+	r.Evaluate(pw, currentRevision, updateRevision, pods)
+	fakeClock.Step(maxBackoff)
+	statuses, requeueAfter := r.Evaluate(pw, currentRevision, updateRevision, pods)
+	if len(server.payloads) != 3 {
+		t.Fatalf("gate called %d times after approval, want 3", len(server.payloads))
+	}
+	if statuses[0].Phase != workloadv1alpha1.GatePhaseApproved || requeueAfter != 0 {
+		t.Errorf("got phase %s and requeueAfter %v, want Approved and 0", statuses[0].Phase, requeueAfter)
+	}
+
+	// A new revision is asked again
+	r.Evaluate(pw, currentRevision, "test-pw-3333", pods)
+	if len(server.payloads) != 4 {
+		t.Fatalf("gate called %d times for a new revision, want 4", len(server.payloads))
+	}
+}
+
+func TestEvaluateRecordedApproval(t *testing.T) {
+	server := newGateServer(t, http.StatusOK, response{Advance: false})
+	r, _ := newFakeGate(time.Now())
+	pw := getPW(server.URL)
+	checkTime := metav1.Now()
+	pw.Status.Gates = []workloadv1alpha1.GateStatus{{
+		Name:          "tests",
+		Revision:      updateRevision,
+		Phase:         workloadv1alpha1.GatePhaseApproved,
+		LastCheckTime: &checkTime,
+	}}
+
+	statuses, _ := r.Evaluate(pw, currentRevision, updateRevision, getPods())
+	if len(server.payloads) != 0 {
+		t.Errorf("gate called %d times for a recorded approval, want 0", len(server.payloads))
+	}
+	if statuses[0].Phase != workloadv1alpha1.GatePhaseApproved {
+		t.Errorf("phase = %s, want Approved", statuses[0].Phase)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for failures, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		if got := backoff(failures); got != expected {
+			t.Errorf("backoff(%d) = %v, want %v", failures, got, expected)
+		}
+	}
+	if got := backoff(100); got != maxBackoff {
+		t.Errorf("backoff(100) = %v, want %v", got, maxBackoff)
+	}
+}
+
+func getPW(url string) *workloadv1alpha1.PartitionWorkload {
+	replicas, partition := int32(4), int32(2)
+	return &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: v1.NamespaceDefault,
+			Name:      testPWName,
+			UID:       "test",
+		},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Replicas:  &replicas,
+			Partition: &partition,
+			Gates:     []workloadv1alpha1.RolloutGate{{Name: "tests", URL: url}},
+		},
+	}
+}
+
+// getPods returns two ready current pods, one ready and one unready updated pod
+func getPods() []*v1.Pod {
+	var pods []*v1.Pod
+	for i, revision := range []string{currentRevision, currentRevision, updateRevision, updateRevision} {
+		ready := v1.ConditionTrue
+		if i == 3 {
+			ready = v1.ConditionFalse
+		}
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: v1.NamespaceDefault,
+				Name:      fmt.Sprintf("%s-%d", testPWName, i),
+				Labels:    map[string]string{apps.ControllerRevisionHashLabelKey: revision},
+			},
+			Status: v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: ready}}},
+		})
+	}
+	return pods
+}
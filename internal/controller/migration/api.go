@@ -0,0 +1,24 @@
+package migration
+
+import (
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type Interface interface {
+	Migrate(pw *workloadv1alpha1.PartitionWorkload, pods []*v1.Pod) (*workloadv1alpha1.PartitionWorkloadCondition, error)
+}
+
+type realMigration struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+func NewMigrationControl(c client.Client, s *runtime.Scheme) Interface {
+	return &realMigration{
+		Client: c,
+		Scheme: s,
+	}
+}
@@ -0,0 +1,134 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
+	refmanager "github.com/2170chm/k8s-partition-workload/internal/util/refmanager"
+)
+
+// Migrate takes over the pods of the Deployment named by the workload.scott.dev/migrate-from annotation of pw
+// and scales the Deployment to zero. Pods are taken over by replacing the controller reference of their
+// ReplicaSet with one to pw, so none of them restart. This happens once, while the Deployment still has
+// replicas; pods its ReplicaSets create before they observe the scale down are left to them.
+//
+// Parameters:
+// - pw: PartitionWorkload to migrate to. Nothing is done if it has no migrate-from annotation.
+// - pods: All active pods in the namespace of pw. Pods taken over are replaced in place by their updated versions.
+//
+// Returns:
+// - *workloadv1alpha1.PartitionWorkloadCondition: Migrated condition to set, or nil if pw is not migrating
+// - error: any error encountered while taking over pods or scaling the Deployment
+func (r *realMigration) Migrate(pw *workloadv1alpha1.PartitionWorkload, pods []*v1.Pod) (*workloadv1alpha1.PartitionWorkloadCondition, error) {
+	name := pw.Annotations[workloadv1alpha1.MigrateFromAnnotationKey]
+	if name == "" || pw.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	deployment := &apps.Deployment{}
+	if err := r.Get(context.TODO(), client.ObjectKey{Namespace: pw.Namespace, Name: name}, deployment); err != nil {
+		if errors.IsNotFound(err) {
+			return newCondition(pw, metav1.ConditionFalse, workloadv1alpha1.ReasonMigrationFailed,
+				fmt.Sprintf("Deployment %s not found", name)), nil
+		}
+		return nil, err
+	}
+
+	if ptr.Deref(deployment.Spec.Replicas, 1) == 0 {
+		if deployment.Status.Replicas > 0 {
+			return newCondition(pw, metav1.ConditionFalse, workloadv1alpha1.ReasonMigrationInProgress,
+				fmt.Sprintf("Waiting for Deployment %s to scale down", name)), nil
+		}
+		return newCondition(pw, metav1.ConditionTrue, workloadv1alpha1.ReasonMigrationComplete,
+			fmt.Sprintf("Took over the pods of Deployment %s and scaled it to zero", name)), nil
+	}
+
+	takenOver, skipped, err := r.takeOverPods(pw, deployment, pods)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := deployment.DeepCopy()
+	updated.Spec.Replicas = ptr.To[int32](0)
+	if err := r.Patch(context.TODO(), updated, client.MergeFrom(deployment)); err != nil {
+		return nil, err
+	}
+
+	klog.InfoS("---- migration ----")
+	klog.InfoS("Took over pods and scaled down the Deployment", "PartitionWorkload", klog.KObj(pw),
+		"deployment", klog.KObj(deployment), "takenOver", takenOver, "skipped", skipped)
+
+	message := fmt.Sprintf("Took over %d pod(s) of Deployment %s, waiting for it to scale down", takenOver, name)
+	if skipped > 0 {
+		message += fmt.Sprintf(", %d pod(s) don't match the selector and are left to it", skipped)
+	}
+	return newCondition(pw, metav1.ConditionFalse, workloadv1alpha1.ReasonMigrationInProgress, message), nil
+}
+
+// takeOverPods makes pw the controller of the pods of the ReplicaSets of deployment that match its selector.
+// The ReplicaSet reference is dropped and the pods are adopted as orphans, each with a single update.
+// It returns the number of pods taken over and of those skipped as they don't match the selector.
+func (r *realMigration) takeOverPods(pw *workloadv1alpha1.PartitionWorkload, deployment *apps.Deployment, pods []*v1.Pod) (
+	int, int, error,
+) {
+	replicaSets := &apps.ReplicaSetList{}
+	if err := r.List(context.TODO(), replicaSets, client.InNamespace(pw.Namespace)); err != nil {
+		return 0, 0, err
+	}
+	owned := map[types.UID]bool{}
+	for i := range replicaSets.Items {
+		if ref := metav1.GetControllerOf(&replicaSets.Items[i]); ref != nil && ref.UID == deployment.UID {
+			owned[replicaSets.Items[i].UID] = true
+		}
+	}
+
+	var candidates []metav1.Object
+	index := map[types.UID]int{}
+	for i, pod := range pods {
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil || !owned[ref.UID] || pod.DeletionTimestamp != nil {
+			continue
+		}
+		orphan := pod.DeepCopy()
+		orphan.OwnerReferences = nil
+		for _, owner := range pod.OwnerReferences {
+			if owner.UID != ref.UID {
+				orphan.OwnerReferences = append(orphan.OwnerReferences, owner)
+			}
+		}
+		candidates = append(candidates, orphan)
+		index[pod.UID] = i
+	}
+	if len(candidates) == 0 {
+		return 0, 0, nil
+	}
+
+	mgr, err := refmanager.NewRefManager(r.Client, pw.Spec.Selector, pw, r.Scheme)
+	if err != nil {
+		return 0, 0, err
+	}
+	claimed, err := mgr.ClaimOwnedObjects(candidates)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, obj := range claimed {
+		pods[index[obj.GetUID()]] = obj.(*v1.Pod)
+	}
+	return len(claimed), len(candidates) - len(claimed), nil
+}
+
+func newCondition(pw *workloadv1alpha1.PartitionWorkload, status metav1.ConditionStatus, reason, message string) *workloadv1alpha1.PartitionWorkloadCondition {
+	cond := condition.NewCondition(workloadv1alpha1.PartitionWorkloadConditionMigrated, status, pw.Generation, reason, message)
+	return &cond
+}
@@ -0,0 +1,155 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+const (
+	testPWName         = "test-pw"
+	testDeploymentName = "test-deployment"
+)
+
+var testLabels = map[string]string{"app": "test-app"}
+
+func TestMigrate(t *testing.T) {
+	scheme := newScheme()
+	pw := newPW(testDeploymentName)
+	deployment := &apps.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: testDeploymentName, Namespace: v1.NamespaceDefault, UID: "deployment-uid"},
+		Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](3)},
+		Status:     apps.DeploymentStatus{Replicas: 3},
+	}
+	replicaSet := &apps.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "test-rs", Namespace: v1.NamespaceDefault, UID: "rs-uid"}}
+	replicaSet.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(deployment, apps.SchemeGroupVersion.WithKind("Deployment"))}
+	otherReplicaSet := &apps.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "other-rs", Namespace: v1.NamespaceDefault, UID: "other-rs-uid"}}
+
+	matching := newPod("matching", testLabels, replicaSet)
+	unmatched := newPod("unmatched", map[string]string{"app": "other"}, replicaSet)
+	foreign := newPod("foreign", testLabels, otherReplicaSet)
+	pods := []*v1.Pod{matching, unmatched, foreign}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(pw, deployment, replicaSet, otherReplicaSet, matching, unmatched, foreign).Build()
+	r := &realMigration{Client: c, Scheme: scheme}
+
+	cond, err := r.Migrate(pw, pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != workloadv1alpha1.ReasonMigrationInProgress {
+		t.Fatalf("expected an in progress Migrated condition, got %+v", cond)
+	}
+	if want := "Took over 1 pod(s) of Deployment test-deployment, waiting for it to scale down, " +
+		"1 pod(s) don't match the selector and are left to it"; cond.Message != want {
+		t.Errorf("want message %q got %q", want, cond.Message)
+	}
+
+	if ref := metav1.GetControllerOf(pods[0]); ref == nil || ref.UID != pw.UID || len(pods[0].OwnerReferences) != 1 {
+		t.Errorf("expected the matching pod to be taken over, got owners %v", pods[0].OwnerReferences)
+	}
+	stored := &v1.Pod{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(matching), stored); err != nil {
+		t.Fatal(err)
+	}
+	if ref := metav1.GetControllerOf(stored); ref == nil || ref.UID != pw.UID {
+		t.Errorf("taking over the pod was not persisted, got owners %v", stored.OwnerReferences)
+	}
+	for _, pod := range pods[1:] {
+		if ref := metav1.GetControllerOf(pod); ref == nil || ref.UID == pw.UID {
+			t.Errorf("pod %s should not have been taken over", pod.Name)
+		}
+	}
+
+	scaled := &apps.Deployment{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(deployment), scaled); err != nil {
+		t.Fatal(err)
+	}
+	if ptr.Deref(scaled.Spec.Replicas, 1) != 0 {
+		t.Errorf("expected the Deployment to be scaled to zero, got %v replicas", ptr.Deref(scaled.Spec.Replicas, 1))
+	}
+
+	// The Deployment has not scaled down yet
+	cond, err = r.Migrate(pw, pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Reason != workloadv1alpha1.ReasonMigrationInProgress {
+		t.Errorf("expected the migration to be in progress, got %+v", cond)
+	}
+
+	scaled.Status.Replicas = 0
+	if err := c.Status().Update(context.TODO(), scaled); err != nil {
+		t.Fatal(err)
+	}
+	cond, err = r.Migrate(pw, pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond.Status != metav1.ConditionTrue || cond.Reason != workloadv1alpha1.ReasonMigrationComplete {
+		t.Errorf("expected the migration to be complete, got %+v", cond)
+	}
+}
+
+func TestMigrateWithoutDeployment(t *testing.T) {
+	scheme := newScheme()
+	r := &realMigration{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+
+	cond, err := r.Migrate(newPW(""), nil)
+	if err != nil || cond != nil {
+		t.Errorf("expected nothing to be done without the annotation, got %+v, %v", cond, err)
+	}
+
+	cond, err = r.Migrate(newPW("missing"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != workloadv1alpha1.ReasonMigrationFailed {
+		t.Errorf("expected a failed Migrated condition, got %+v", cond)
+	}
+}
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workloadv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1.AddToScheme(scheme))
+	utilruntime.Must(apps.AddToScheme(scheme))
+	return scheme
+}
+
+func newPW(migrateFrom string) *workloadv1alpha1.PartitionWorkload {
+	pw := &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{Name: testPWName, Namespace: v1.NamespaceDefault, UID: "pw-uid"},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+		},
+	}
+	if migrateFrom != "" {
+		pw.Annotations = map[string]string{workloadv1alpha1.MigrateFromAnnotationKey: migrateFrom}
+	}
+	return pw
+}
+
+func newPod(name string, labels map[string]string, owner *apps.ReplicaSet) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       v1.NamespaceDefault,
+			UID:             types.UID(name + "-uid"),
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, apps.SchemeGroupVersion.WithKind("ReplicaSet"))},
+		},
+	}
+}
@@ -2,13 +2,16 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	klog "k8s.io/klog/v2"
 	kubecontroller "k8s.io/kubernetes/pkg/controller"
 	history "k8s.io/kubernetes/pkg/controller/history"
@@ -18,29 +21,59 @@ import (
 	reconcile "sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	analysis "github.com/2170chm/k8s-partition-workload/internal/controller/analysis"
 	condition "github.com/2170chm/k8s-partition-workload/internal/controller/condition"
-	"github.com/2170chm/k8s-partition-workload/internal/controller/config"
+	config "github.com/2170chm/k8s-partition-workload/internal/controller/config"
+	gate "github.com/2170chm/k8s-partition-workload/internal/controller/gate"
+	migration "github.com/2170chm/k8s-partition-workload/internal/controller/migration"
 	revision "github.com/2170chm/k8s-partition-workload/internal/controller/revision"
 	status "github.com/2170chm/k8s-partition-workload/internal/controller/status"
 	sync "github.com/2170chm/k8s-partition-workload/internal/controller/sync"
+	traffic "github.com/2170chm/k8s-partition-workload/internal/controller/traffic"
 	general "github.com/2170chm/k8s-partition-workload/internal/util/general"
 	refmanager "github.com/2170chm/k8s-partition-workload/internal/util/refmanager"
 )
 
+const (
+	// eventReasonUpdateRevisionChanged is the reason of events summarizing a new update revision
+	eventReasonUpdateRevisionChanged = "UpdateRevisionChanged"
+	// maxChangesInEvent is the number of changes to the pod template listed in an event before the rest are counted
+	maxChangesInEvent = 5
+)
+
 // PartitionWorkloadReconciler reconciles a PartitionWorkload object
 type PartitionWorkloadReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 
-	HistoryControl  history.Interface
-	SyncControl     sync.Interface
-	StatusUpdater   status.Interface
-	RevisionControl revision.Interface
+	HistoryControl   history.Interface
+	SyncControl      sync.Interface
+	StatusUpdater    status.Interface
+	RevisionControl  revision.Interface
+	TrafficControl   traffic.Interface
+	AnalysisControl  analysis.Interface
+	GateControl      gate.Interface
+	MigrationControl migration.Interface
+
+	// Recorder emits the events of PartitionWorkloads, such as what changed with a new update revision
+	Recorder events.EventRecorder
+
+	// DefaultHistoryLimit is the number of non-live revisions kept for PartitionWorkloads that do not set
+	// spec.revisionHistoryLimit
+	DefaultHistoryLimit int32
 }
 
 // +kubebuilder:rbac:groups=workload.scott.dev,resources=partitionworkloads,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=workload.scott.dev,resources=partitionworkloads/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=workload.scott.dev,resources=partitionworkloads/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -78,16 +111,12 @@ func (r *PartitionWorkloadReconciler) Reconcile(ctx context.Context, request ctr
 	// klog.InfoS("---- pods update ----")
 	// klog.InfoS("All activePods", "detail", klog.KObjSlice(activePods))
 
-	// Claim/release pod ownership using label selector matching
-	// This adopts pods that match our selector but aren't owned, and releases pods that don't match
-	claimedPods, err := r.claimPods(instance, r.Scheme, activePods)
+	// Take over the pods of the Deployment we migrate from, if any, before claiming pods
+	migrated, err := r.MigrationControl.Migrate(instance, activePods)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	klog.InfoS("---- pods update ----")
-	klog.InfoS("Claimed pods", "detail", klog.KObjSlice(claimedPods))
-
 	// Revisions
 	revisions, err := r.HistoryControl.ListControllerRevisions(instance, selector)
 	if err != nil {
@@ -110,40 +139,108 @@ func (r *PartitionWorkloadReconciler) Reconcile(ctx context.Context, request ctr
 	klog.InfoS("updatedRevision", "detail", klog.KObj(updateRevision))
 	klog.InfoS("collisionCount", "count", collisionCount)
 
+	// Claim/release pod ownership using label selector matching
+	// This adopts pods that match our selector but aren't owned, as far as the adoption policy allows,
+	// and releases pods that don't match. Revisions come first so that adoption can match pods against them
+	known := knownRevisions(revisions, updateRevision)
+	claimedPods, err := r.claimPods(instance, r.Scheme, activePods, known)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Adopted pods without a revision hash would otherwise never count as updated
+	if err = r.labelPodRevisions(instance, claimedPods, known); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	klog.InfoS("---- pods update ----")
+	klog.InfoS("Claimed pods", "detail", klog.KObjSlice(claimedPods))
+
 	newStatus := workloadv1alpha1.PartitionWorkloadStatus{
 		ObservedGeneration: instance.Generation,
 		CurrentRevision:    currentRevision.Name,
 		UpdateRevision:     updateRevision.Name,
 		CollisionCount:     &collisionCount,
+		// Conditions are carried over so that their transition times survive the reconcile
+		Conditions: append([]workloadv1alpha1.PartitionWorkloadCondition(nil), instance.Status.Conditions...),
 	}
 
+	// Surface pods we can't claim because another controller owns them, as the owners would fight over them
+	updateSelectorOverlapCondition(instance, &newStatus, selector, activePods)
+
+	if migrated != nil {
+		condition.SetCondition(&newStatus, *migrated)
+	} else {
+		condition.RemoveCondition(&newStatus, workloadv1alpha1.PartitionWorkloadConditionMigrated)
+	}
+
+	// Gate how far the rollout may advance on the analysis of the update revision
+	partition, requeueAfter := r.gatePartition(instance, &newStatus, currentRevision.Name, updateRevision.Name, claimedPods)
+
 	// Core logic to scale and update pods
-	syncErr := r.syncPods(instance, &newStatus, currentRevision, updateRevision, claimedPods)
+	syncErr := r.syncPods(instance, &newStatus, currentRevision, updateRevision, claimedPods, partition)
+
+	// Clean up history that's above of the limit. This runs before the status update so that status.revisionHistory
+	// only lists the revisions that are kept, as revisions don't trigger reconciles
+	kept, err := r.truncateHistory(instance, claimedPods, known, currentRevision, updateRevision)
+	if err != nil {
+		klog.ErrorS(err, "Failed to truncate history for PartitionWorkload", "PartitionWorkload", request)
+	}
 
 	// Update the status of the resource
-	if err = r.StatusUpdater.UpdateStatus(instance, &newStatus, claimedPods); err != nil {
+	if err = r.StatusUpdater.UpdateStatus(instance, &newStatus, claimedPods, kept); err != nil {
 		return reconcile.Result{}, err
 	}
 
-	// Clean up history that's above of the limit
-	if err = r.truncateHistory(claimedPods, revisions, currentRevision, updateRevision); err != nil {
-		klog.ErrorS(err, "Failed to truncate history for PartitionWorkload", "PartitionWorkload", request)
+	// Tell what changed in the pod template once the new update revision is recorded
+	r.recordUpdateRevisionChange(instance, updateRevision, known)
+
+	// Shift traffic between revisions if the workload is fronted by an HTTPRoute.
+	// This runs after the status update so that a completed rollout sends all traffic to the new current revision
+	if err = r.TrafficControl.SyncTraffic(instance, newStatus.CurrentRevision, newStatus.UpdateRevision, claimedPods); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Keep the role labels of pods in line with the revisions, which may have just changed with the status
+	if err = r.SyncControl.SyncPodRoles(newStatus.CurrentRevision, newStatus.UpdateRevision, claimedPods); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Fields left out of revisions are updated in place rather than by a rollout
+	if err = r.SyncControl.SyncIgnoredFields(instance, claimedPods); err != nil {
+		return reconcile.Result{}, err
 	}
 
 	if syncErr != nil {
 		klog.InfoS("---- sync error ----")
 		klog.ErrorS(syncErr, "Failed to sync pods for PartitionWorkload", "PartitionWorkload", request)
+		// Return the syncErr. If there is a syncErr, controller will requeue
+		return reconcile.Result{}, syncErr
+	}
+
+	// Ready pods become available after minReadySeconds without any event, so check them again by then
+	if minReady := time.Duration(instance.Spec.MinReadySeconds) * time.Second; minReady > 0 &&
+		newStatus.AvailableReplicas < newStatus.ReadyReplicas && (requeueAfter == 0 || minReady < requeueAfter) {
+		requeueAfter = minReady
+	}
+
+	// Nothing about the Deployment we migrate from triggers a reconcile, so poll it until it has scaled down
+	if migrated != nil && migrated.Reason == workloadv1alpha1.ReasonMigrationInProgress &&
+		(requeueAfter == 0 || config.MigrationPollInterval < requeueAfter) {
+		requeueAfter = config.MigrationPollInterval
 	}
 
 	klog.InfoS("Successfully reconciled without errors")
-	// Return the syncErr. If there is a syncErr, controller will requeue
-	return reconcile.Result{}, syncErr
+	// Requeue for the next analysis evaluation if the rollout is gated, or for pods becoming available
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PartitionWorkloadReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&workloadv1alpha1.PartitionWorkload{}).
+		// Pod readiness drives traffic weights, so owned pods trigger reconciles as well
+		Owns(&v1.Pod{}).
 		Named("partitionworkload").
 		Complete(r)
 }
@@ -163,14 +260,27 @@ func (r *PartitionWorkloadReconciler) getActivePods(instance *workloadv1alpha1.P
 	return activePods, nil
 }
 
-func (r *PartitionWorkloadReconciler) claimPods(instance *workloadv1alpha1.PartitionWorkload, scheme *runtime.Scheme, pods []*v1.Pod) ([]*v1.Pod, error) {
+func (r *PartitionWorkloadReconciler) claimPods(instance *workloadv1alpha1.PartitionWorkload, scheme *runtime.Scheme, pods []*v1.Pod,
+	revisions []*apps.ControllerRevision,
+) ([]*v1.Pod, error) {
 	mgr, err := refmanager.NewRefManager(r.Client, instance.Spec.Selector, instance, scheme)
 	if err != nil {
 		return nil, err
 	}
-	selected := make([]metav1.Object, len(pods))
-	for i, pod := range pods {
-		selected[i] = pod
+	// Orphans that may not be adopted are left out. Pods that already have an owner are always passed on,
+	// so that the RefManager keeps or releases ours
+	var selected []metav1.Object
+	for _, pod := range pods {
+		if metav1.GetControllerOf(pod) == nil {
+			adoptable, err := r.canAdoptPod(instance, pod, revisions)
+			if err != nil {
+				return nil, err
+			}
+			if !adoptable {
+				continue
+			}
+		}
+		selected = append(selected, pod)
 	}
 
 	claimed, err := mgr.ClaimOwnedObjects(selected)
@@ -186,6 +296,134 @@ func (r *PartitionWorkloadReconciler) claimPods(instance *workloadv1alpha1.Parti
 	return claimedPods, nil
 }
 
+// canAdoptPod returns true if the orphaned pod may be adopted under spec.adoptionPolicy. Pods that opted out
+// through the workload.scott.dev/adopt annotation are never adopted.
+func (r *PartitionWorkloadReconciler) canAdoptPod(instance *workloadv1alpha1.PartitionWorkload, pod *v1.Pod,
+	revisions []*apps.ControllerRevision,
+) (bool, error) {
+	if pod.Annotations[workloadv1alpha1.AdoptAnnotationKey] == "false" {
+		return false, nil
+	}
+	switch instance.Spec.AdoptionPolicy {
+	case workloadv1alpha1.AdoptionPolicyNever:
+		return false, nil
+	case workloadv1alpha1.AdoptionPolicyIfRevisionMatches:
+		revision, err := r.RevisionControl.MatchRevision(instance, pod, revisions)
+		return revision != nil, err
+	default:
+		return true, nil
+	}
+}
+
+// labelPodRevisions labels the claimed pods that lack a revision hash, typically adopted ones, with the hash of
+// the newest revision their spec matches, or with UnknownRevisionHash if there is none. Pods are replaced in
+// place by their patched versions.
+func (r *PartitionWorkloadReconciler) labelPodRevisions(instance *workloadv1alpha1.PartitionWorkload, pods []*v1.Pod,
+	revisions []*apps.ControllerRevision,
+) error {
+	var patched []*v1.Pod
+	for i, pod := range pods {
+		if _, ok := pod.Labels[apps.ControllerRevisionHashLabelKey]; ok {
+			continue
+		}
+		revision, err := r.RevisionControl.MatchRevision(instance, pod, revisions)
+		if err != nil {
+			return err
+		}
+		updated := pod.DeepCopy()
+		if revision != nil {
+			sync.WriteRevisionHash(updated, revision.Name)
+		} else {
+			if updated.Labels == nil {
+				updated.Labels = map[string]string{}
+			}
+			updated.Labels[apps.ControllerRevisionHashLabelKey] = workloadv1alpha1.UnknownRevisionHash
+		}
+		if err := r.Patch(context.TODO(), updated, client.MergeFrom(pod)); err != nil {
+			return err
+		}
+		pods[i] = updated
+		patched = append(patched, updated)
+	}
+
+	if len(patched) > 0 {
+		klog.InfoS("---- pods update ----")
+		klog.InfoS("Labeled the revisions of adopted pods", "pods", klog.KObjSlice(patched))
+	}
+	return nil
+}
+
+// knownRevisions returns the sorted revisions of the PartitionWorkload with the update revision, which may have
+// just been created or renumbered, as the newest one
+func knownRevisions(revisions []*apps.ControllerRevision, updateRevision *apps.ControllerRevision) []*apps.ControllerRevision {
+	known := make([]*apps.ControllerRevision, 0, len(revisions)+1)
+	for _, revision := range revisions {
+		if revision.Name != updateRevision.Name {
+			known = append(known, revision)
+		}
+	}
+	return append(known, updateRevision)
+}
+
+// recordUpdateRevisionChange emits an event summarizing the changes to the pod template when the update revision
+// differs from the one in the status of the PartitionWorkload. Nothing is emitted for the first revision or when
+// the previous update revision is gone.
+func (r *PartitionWorkloadReconciler) recordUpdateRevisionChange(instance *workloadv1alpha1.PartitionWorkload,
+	updateRevision *apps.ControllerRevision, revisions []*apps.ControllerRevision,
+) {
+	previous := instance.Status.UpdateRevision
+	if previous == "" || previous == updateRevision.Name {
+		return
+	}
+	var from *apps.ControllerRevision
+	for _, revision := range revisions {
+		if revision.Name == previous {
+			from = revision
+		}
+	}
+	if from == nil {
+		return
+	}
+
+	diff, err := r.RevisionControl.DiffRevisions(instance, from, updateRevision)
+	if err != nil {
+		klog.ErrorS(err, "Failed to diff revisions", "PartitionWorkload", klog.KObj(instance),
+			"from", previous, "to", updateRevision.Name)
+		return
+	}
+	r.Recorder.Eventf(instance, nil, v1.EventTypeNormal, eventReasonUpdateRevisionChanged, "Rollout",
+		"Update revision changed from %s to %s: %s", previous, updateRevision.Name, diff.Summary(maxChangesInEvent))
+}
+
+// updateSelectorOverlapCondition sets the SelectorOverlap condition when some of the pods matching the selector
+// are controlled by another owner, naming that owner, and removes it otherwise.
+func updateSelectorOverlapCondition(instance *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus,
+	selector labels.Selector, pods []*v1.Pod,
+) {
+	var owner *metav1.OwnerReference
+	count := 0
+	for _, pod := range pods {
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil || ref.UID == instance.UID || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if owner == nil {
+			owner = ref
+		}
+		count++
+	}
+
+	if owner == nil {
+		condition.RemoveCondition(newStatus, workloadv1alpha1.PartitionWorkloadConditionSelectorOverlap)
+		return
+	}
+	condition.SetCondition(newStatus, condition.NewCondition(
+		workloadv1alpha1.PartitionWorkloadConditionSelectorOverlap, metav1.ConditionTrue, instance.Generation,
+		workloadv1alpha1.ReasonPodsOwnedByOther,
+		fmt.Sprintf("%d pod(s) matching the selector are controlled by %s %s", count, owner.Kind, owner.Name),
+	))
+}
+
 func (r *PartitionWorkloadReconciler) getActiveRevisions(instance *workloadv1alpha1.PartitionWorkload, revisions []*apps.ControllerRevision) (
 	*apps.ControllerRevision, *apps.ControllerRevision, int32, error,
 ) {
@@ -255,7 +493,7 @@ func (r *PartitionWorkloadReconciler) getActiveRevisions(instance *workloadv1alp
 
 func (r *PartitionWorkloadReconciler) syncPods(
 	instance *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus,
-	currentRevision, updateRevision *apps.ControllerRevision, pods []*v1.Pod,
+	currentRevision, updateRevision *apps.ControllerRevision, pods []*v1.Pod, partition *int32,
 ) error {
 	// If PartitionWorkload is being deleted, just let garbage collection clean up pods
 	if instance.DeletionTimestamp != nil {
@@ -275,6 +513,18 @@ func (r *PartitionWorkloadReconciler) syncPods(
 		return err
 	}
 
+	// Pods created at the update revision carry the canary overrides while the rollout is partial
+	if currentRevision.Name != updateRevision.Name {
+		if updatedPW, err = r.RevisionControl.ApplyCanaryOverrides(updatedPW); err != nil {
+			return err
+		}
+	}
+
+	// Sync towards the gated partition rather than spec.partition if the rollout is gated
+	if partition != nil {
+		updatedPW.Spec.Partition = partition
+	}
+
 	klog.InfoS("---- partition workload definition update ----")
 	klog.InfoS("currentPW definition", "detail", currentPW)
 	klog.InfoS("updatedPW definition", "detail", updatedPW)
@@ -284,13 +534,17 @@ func (r *PartitionWorkloadReconciler) syncPods(
 	// Returns scaling=true if scale operation is in progress (skip updates until stable)
 	err = r.SyncControl.ScaleAndUpdate(currentPW, updatedPW, currentRevision.Name, updateRevision.Name, pods)
 	if err != nil {
-		cond := workloadv1alpha1.PartitionWorkloadCondition{
-			Type:               workloadv1alpha1.PartionWorkloadConditionFailedScale,
-			Status:             v1.ConditionTrue,
-			LastTransitionTime: metav1.Now(),
-			Message:            err.Error(),
+		for _, condType := range []string{
+			workloadv1alpha1.PartitionWorkloadConditionFailedScale, workloadv1alpha1.PartitionWorkloadConditionReplicaFailure,
+		} {
+			condition.SetCondition(newStatus, condition.NewCondition(
+				condType, metav1.ConditionTrue, instance.Generation, workloadv1alpha1.ReasonFailedScale, err.Error(),
+			))
 		}
-		condition.SetCondition(newStatus, cond)
+	} else {
+		// Pods are in sync again, so earlier failures no longer apply
+		condition.RemoveCondition(newStatus, workloadv1alpha1.PartitionWorkloadConditionFailedScale)
+		condition.RemoveCondition(newStatus, workloadv1alpha1.PartitionWorkloadConditionReplicaFailure)
 	}
 
 	return err
@@ -299,18 +553,20 @@ func (r *PartitionWorkloadReconciler) syncPods(
 // truncateHistory truncates any non-live ControllerRevisions in revisions from pw's history. The UpdateRevision and
 // CurrentRevision in pw's Status are considered to be live. Any revisions associated with the Pods in pods are also
 // considered to be live. Non-live revisions are deleted, starting with the revision with the lowest Revision, until
-// only RevisionHistoryLimit revisions remain. If the returned error is nil the operation was successful. This method
-// expects that revisions is sorted when supplied.
+// only spec.revisionHistoryLimit revisions, or DefaultHistoryLimit if unset, remain. It returns the revisions that
+// were not deleted, even on error. If the returned error is nil the operation was successful. This method expects
+// that revisions is sorted when supplied.
 //
 // Live revisions = revisions actively used by pods or tracked in status
 // Historic revisions = old unused revisions that can be garbage collected
 // This prevents unbounded growth of ControllerRevision objects
 func (r *PartitionWorkloadReconciler) truncateHistory(
+	instance *workloadv1alpha1.PartitionWorkload,
 	pods []*v1.Pod,
 	revisions []*apps.ControllerRevision,
 	current *apps.ControllerRevision,
 	update *apps.ControllerRevision,
-) error {
+) ([]*apps.ControllerRevision, error) {
 	nonLiveRevisions := make([]*apps.ControllerRevision, 0, len(revisions))
 
 	// Identify which revisions are still in use:
@@ -337,23 +593,36 @@ func (r *PartitionWorkloadReconciler) truncateHistory(
 	// pod or is the updaterevision or the currenrevision of PartitionWorkload
 	// It does not represent the total number of controllerrevisions
 	historySize := len(nonLiveRevisions)
-	historyLimit := config.DefaultHistoryLimit
+	historyLimit := int(r.DefaultHistoryLimit)
+	if instance.Spec.RevisionHistoryLimit != nil {
+		historyLimit = int(*instance.Spec.RevisionHistoryLimit)
+	}
 
 	klog.InfoS("---- truncate history ----")
 	klog.InfoS("Calculated history metrics", "history size", historySize, "history limit", historyLimit)
 
 	if historySize <= historyLimit {
-		return nil
+		return revisions, nil
 	}
 
 	// Delete oldest non-live revisions first (array is sorted oldest to newest)
 	// Keep only the most recent 'historyLimit' revisions for potential rollback
 	nonLiveRevisions = nonLiveRevisions[:(historySize - historyLimit)]
+	deleted := make(map[string]bool, len(nonLiveRevisions))
+	var err error
 	for i := 0; i < len(nonLiveRevisions); i++ {
 		klog.InfoS("Deleting revision", "revision", klog.KObj(nonLiveRevisions[i]))
-		if err := r.HistoryControl.DeleteControllerRevision(nonLiveRevisions[i]); err != nil {
-			return err
+		if err = r.HistoryControl.DeleteControllerRevision(nonLiveRevisions[i]); err != nil {
+			break
 		}
+		deleted[nonLiveRevisions[i].Name] = true
 	}
-	return nil
+
+	kept := make([]*apps.ControllerRevision, 0, len(revisions)-len(deleted))
+	for _, revision := range revisions {
+		if !deleted[revision.Name] {
+			kept = append(kept, revision)
+		}
+	}
+	return kept, err
 }
@@ -2,12 +2,14 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/onsi/gomega"
 	apps "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
 	client "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
@@ -15,6 +17,8 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/config"
 	"github.com/2170chm/k8s-partition-workload/internal/controller/revision"
 	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
 	historyutil "github.com/2170chm/k8s-partition-workload/internal/util/history"
@@ -28,9 +32,12 @@ func TestClaimPods(t *testing.T) {
 	v1.AddToScheme(scheme)
 
 	pw := newPW(testCurrentImage)
+	optedOut := newPod("pod5", testLabel, nil)
+	optedOut.Annotations = map[string]string{workloadv1alpha1.AdoptAnnotationKey: "false"}
 
 	type test struct {
 		name    string
+		policy  workloadv1alpha1.AdoptionPolicy
 		pods    []*v1.Pod
 		claimed []*v1.Pod
 	}
@@ -45,23 +52,157 @@ func TestClaimPods(t *testing.T) {
 			pods:    []*v1.Pod{newPod("pod3", testLabel, nil), newPod("pod4", nilLabel, nil)},
 			claimed: []*v1.Pod{newPod("pod3", testLabel, nil)},
 		},
+		{
+			name:    "Don't adopt pods that opted out",
+			pods:    []*v1.Pod{optedOut},
+			claimed: nil,
+		},
+		{
+			name:    "Never adopt orphans but keep owned pods",
+			policy:  workloadv1alpha1.AdoptionPolicyNever,
+			pods:    []*v1.Pod{newPod("pod6", testLabel, pw), newPod("pod7", testLabel, nil)},
+			claimed: []*v1.Pod{newPod("pod6", testLabel, pw)},
+		},
+		{
+			name:    "Adopt only orphans matching a revision",
+			policy:  workloadv1alpha1.AdoptionPolicyIfRevisionMatches,
+			pods:    []*v1.Pod{newPodWithImage("pod8", testCurrentImage), newPodWithImage("pod9", "busybox")},
+			claimed: []*v1.Pod{newPodWithImage("pod8", testCurrentImage)},
+		},
 	}
 
 	for _, tt := range tests {
+		pw := pw.DeepCopy()
+		pw.Spec.AdoptionPolicy = tt.policy
 		initObjs := []client.Object{pw}
 		for i := range tt.pods {
 			initObjs = append(initObjs, tt.pods[i])
 		}
 
 		reconciler := newFakeControl(scheme, initObjs)
+		revision, err := reconciler.RevisionControl.NewRevision(pw, 1, generalutil.Int32Ptr(0))
+		g.Expect(err).NotTo(gomega.HaveOccurred())
 
-		claimed, err := reconciler.claimPods(pw, scheme, tt.pods)
+		claimed, err := reconciler.claimPods(pw, scheme, tt.pods, []*apps.ControllerRevision{revision})
 		g.Expect(err).NotTo(gomega.HaveOccurred())
 		g.Expect(reflect.DeepEqual(podToStringSlice(tt.claimed), podToStringSlice(claimed))).To(gomega.BeTrue(),
 			"Test case `%s`, claimed wrong pods. Expected %v, got %v", tt.name, podToStringSlice(tt.claimed), podToStringSlice(claimed))
 	}
 }
 
+func TestLabelPodRevisions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(workloadv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(v1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	pw := newPW(testCurrentImage)
+	matching := newPodWithImage("matching", testCurrentImage)
+	unknown := newPodWithImage("unknown", "busybox")
+	labeled := newPodWithImage("labeled", "busybox")
+	labeled.Labels = map[string]string{apps.ControllerRevisionHashLabelKey: "pw-1"}
+	pods := []*v1.Pod{matching, unknown, labeled}
+
+	r := newFakeControl(scheme, []client.Object{pw, matching, unknown, labeled})
+	revision, err := r.RevisionControl.NewRevision(pw, 1, generalutil.Int32Ptr(0))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(r.labelPodRevisions(pw, pods, []*apps.ControllerRevision{revision})).To(gomega.Succeed())
+	g.Expect(pods[0].Labels).To(gomega.HaveKeyWithValue(apps.ControllerRevisionHashLabelKey, revision.Name))
+	g.Expect(pods[0].Labels).To(gomega.HaveKeyWithValue(apps.DefaultDeploymentUniqueLabelKey, generalutil.GetShortHash(revision.Name)))
+	g.Expect(pods[1].Labels).To(gomega.HaveKeyWithValue(apps.ControllerRevisionHashLabelKey, workloadv1alpha1.UnknownRevisionHash))
+	g.Expect(pods[2].Labels).To(gomega.HaveKeyWithValue(apps.ControllerRevisionHashLabelKey, "pw-1"))
+
+	stored := &v1.Pod{}
+	g.Expect(r.Client.Get(context.TODO(), client.ObjectKeyFromObject(matching), stored)).To(gomega.Succeed())
+	g.Expect(stored.Labels).To(gomega.HaveKeyWithValue(apps.ControllerRevisionHashLabelKey, revision.Name))
+}
+
+func TestRecordUpdateRevisionChange(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(workloadv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(v1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	pw := newPW("nginx:1.25")
+	r := newFakeControl(scheme, []client.Object{pw})
+	recorder := events.NewFakeRecorder(10)
+	r.Recorder = recorder
+
+	previous, err := r.RevisionControl.NewRevision(pw, 1, generalutil.Int32Ptr(0))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	pw.Spec.Template.Spec.Containers[0].Image = "nginx:1.27"
+	update, err := r.RevisionControl.NewRevision(pw, 2, generalutil.Int32Ptr(0))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	revisions := []*apps.ControllerRevision{previous, update}
+
+	// The first update revision and an unchanged one are not announced
+	r.recordUpdateRevisionChange(pw, update, revisions)
+	pw.Status.UpdateRevision = update.Name
+	r.recordUpdateRevisionChange(pw, update, revisions)
+	g.Expect(recorder.Events).To(gomega.BeEmpty())
+
+	pw.Status.UpdateRevision = previous.Name
+	r.recordUpdateRevisionChange(pw, update, revisions)
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.Equal(fmt.Sprintf(
+		"Normal UpdateRevisionChanged Update revision changed from %s to %s: image nginx:1.25 → 1.27", previous.Name, update.Name))))
+}
+
+func TestUpdateSelectorOverlapCondition(t *testing.T) {
+	pw := newPW(testCurrentImage)
+	other := &workloadv1alpha1.PartitionWorkload{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other-uid"}}
+	selector, err := metav1.LabelSelectorAsSelector(pw.Spec.Selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		pods        []*v1.Pod
+		wantOverlap bool
+		wantMessage string
+	}{
+		{
+			name:        "Pods owned by us or orphaned don't overlap",
+			pods:        []*v1.Pod{newPod("pod1", testLabel, pw), newPod("pod2", testLabel, nil)},
+			wantOverlap: false,
+		},
+		{
+			name:        "Pods owned by another controller that don't match the selector don't overlap",
+			pods:        []*v1.Pod{newPod("pod1", nilLabel, other)},
+			wantOverlap: false,
+		},
+		{
+			name:        "Matching pods owned by another controller overlap",
+			pods:        []*v1.Pod{newPod("pod1", testLabel, pw), newPod("pod2", testLabel, other), newPod("pod3", testLabel, other)},
+			wantOverlap: true,
+			wantMessage: "2 pod(s) matching the selector are controlled by Fake other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newStatus := &workloadv1alpha1.PartitionWorkloadStatus{
+				Conditions: []workloadv1alpha1.PartitionWorkloadCondition{{Type: workloadv1alpha1.PartitionWorkloadConditionSelectorOverlap, Status: metav1.ConditionTrue}},
+			}
+			updateSelectorOverlapCondition(pw, newStatus, selector, tt.pods)
+
+			cond := condition.GetCondition(*newStatus, workloadv1alpha1.PartitionWorkloadConditionSelectorOverlap)
+			if !tt.wantOverlap {
+				if cond != nil {
+					t.Errorf("expected no SelectorOverlap condition, got %+v", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != metav1.ConditionTrue || cond.Message != tt.wantMessage {
+				t.Errorf("expected SelectorOverlap condition with message %q, got %+v", tt.wantMessage, cond)
+			}
+		})
+	}
+}
+
 func TestGetActiveRevisions(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -201,6 +342,70 @@ func TestGetActiveRevisions(t *testing.T) {
 	}
 }
 
+func TestTruncateHistory(t *testing.T) {
+	tests := []struct {
+		name              string
+		historyLimit      *int32
+		expectedRemaining []int
+	}{
+		{
+			name:              "Default limit keeps every non-live revision",
+			expectedRemaining: []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:              "Limit keeps the newest non-live revisions",
+			historyLimit:      generalutil.Int32Ptr(1),
+			expectedRemaining: []int{2, 4, 5, 6},
+		},
+		{
+			name:              "Zero limit keeps only live revisions",
+			historyLimit:      generalutil.Int32Ptr(0),
+			expectedRemaining: []int{2, 5, 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+
+			scheme := runtime.NewScheme()
+			g.Expect(workloadv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+			g.Expect(v1.AddToScheme(scheme)).To(gomega.Succeed())
+			g.Expect(apps.AddToScheme(scheme)).To(gomega.Succeed())
+
+			r := newFakeControl(scheme, nil)
+
+			var revisions []*apps.ControllerRevision
+			for i := 1; i <= 6; i++ {
+				revision, err := r.RevisionControl.NewRevision(newPW(fmt.Sprintf("nginx:%d", i)), int64(i), generalutil.Int32Ptr(0))
+				g.Expect(err).NotTo(gomega.HaveOccurred())
+				g.Expect(r.Client.Create(context.TODO(), revision)).To(gomega.Succeed())
+				revisions = append(revisions, revision)
+			}
+			pw := newPW(testCurrentImage)
+			pw.Spec.RevisionHistoryLimit = tt.historyLimit
+			// Revision 2 is live through a pod, 5 and 6 are the current and update revisions
+			pods := []*v1.Pod{newPod("pod", map[string]string{apps.ControllerRevisionHashLabelKey: revisions[1].Name}, pw)}
+
+			kept, err := r.truncateHistory(pw, pods, revisions, revisions[4], revisions[5])
+			g.Expect(err).NotTo(gomega.HaveOccurred())
+
+			var list apps.ControllerRevisionList
+			g.Expect(r.Client.List(context.TODO(), &list)).To(gomega.Succeed())
+			var remaining, keptNumbers []int
+			for _, revision := range list.Items {
+				remaining = append(remaining, int(revision.Revision))
+			}
+			for _, revision := range kept {
+				keptNumbers = append(keptNumbers, int(revision.Revision))
+			}
+			g.Expect(remaining).To(gomega.ConsistOf(tt.expectedRemaining))
+			// The revisions left are the ones status.revisionHistory summarizes, oldest first
+			g.Expect(keptNumbers).To(gomega.Equal(tt.expectedRemaining))
+		})
+	}
+}
+
 func newFakeControl(scheme *runtime.Scheme, initObjs []client.Object) *PartitionWorkloadReconciler {
 	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(initObjs...).Build()
 	return &PartitionWorkloadReconciler{
@@ -208,6 +413,8 @@ func newFakeControl(scheme *runtime.Scheme, initObjs []client.Object) *Partition
 		Scheme:          scheme,
 		HistoryControl:  historyutil.NewHistory(fakeClient),
 		RevisionControl: revision.NewRevisionControl(fakeClient, scheme),
+
+		DefaultHistoryLimit: config.DefaultHistoryLimit,
 	}
 }
 
@@ -233,6 +440,12 @@ func newPod(podName string, label map[string]string, owner metav1.Object) *v1.Po
 	return pod
 }
 
+func newPodWithImage(podName, image string) *v1.Pod {
+	pod := newPod(podName, testLabel, nil)
+	pod.Spec.Containers = []v1.Container{{Name: image, Image: image}}
+	return pod
+}
+
 func newPW(image string) *workloadv1alpha1.PartitionWorkload {
 	return &workloadv1alpha1.PartitionWorkload{
 		ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	analysis "github.com/2170chm/k8s-partition-workload/internal/controller/analysis"
+	general "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+// gatePartition decides how far the rollout may advance towards spec.partition. It returns the partition to
+// sync pods with, or nil if spec.partition can be used as is, and how long to wait before the next evaluation.
+// The analysis and the rollout gates are evaluated independently and the most restrictive result wins. A paused
+// rollout holds at the pods already updated.
+func (r *PartitionWorkloadReconciler) gatePartition(
+	instance *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus,
+	currentRevision, updateRevision string, pods []*v1.Pod,
+) (*int32, time.Duration) {
+	analysisPartition, analysisRequeue := r.gateAnalysis(instance, newStatus, currentRevision, updateRevision, pods)
+	gatesPartition, gatesRequeue := r.gateWebhooks(instance, newStatus, currentRevision, updateRevision, pods)
+
+	partition := analysisPartition
+	if partition == nil || (gatesPartition != nil && *gatesPartition < *partition) {
+		partition = gatesPartition
+	}
+	requeueAfter := analysisRequeue
+	if requeueAfter == 0 || (gatesRequeue != 0 && gatesRequeue < requeueAfter) {
+		requeueAfter = gatesRequeue
+	}
+	if instance.Spec.Paused && currentRevision != updateRevision {
+		updated := countUpdated(pods, updateRevision)
+		if partition == nil || updated < *partition {
+			partition = &updated
+		}
+	}
+	return partition, requeueAfter
+}
+
+// gateAnalysis gates the rollout on spec.analysis.
+//
+// While pods exist at the update revision the analysis is evaluated every interval and the result is recorded
+// in newStatus. The first canary pod is always allowed so that there is something to measure; further pods are
+// only moved to the update revision while the analysis is successful. On failure the rollout holds, or rolls
+// every pod back to the current revision if the failure policy is Rollback.
+func (r *PartitionWorkloadReconciler) gateAnalysis(
+	instance *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus,
+	currentRevision, updateRevision string, pods []*v1.Pod,
+) (*int32, time.Duration) {
+	spec := instance.Spec.Analysis
+	if spec == nil || instance.Spec.Replicas == nil {
+		newStatus.Analysis = nil
+		return nil, 0
+	}
+	// Keep the last result around for inspection once the rollout is complete
+	newStatus.Analysis = instance.Status.Analysis
+	if currentRevision == updateRevision {
+		return nil, 0
+	}
+
+	result := instance.Status.Analysis
+	if result == nil || result.Revision != updateRevision {
+		now := metav1.Now()
+		result = &workloadv1alpha1.AnalysisStatus{
+			Revision:  updateRevision,
+			Phase:     workloadv1alpha1.AnalysisPhasePending,
+			StartTime: &now,
+		}
+	}
+
+	updated := countUpdated(pods, updateRevision)
+
+	// A rolled back revision stays rolled back until the template changes, so there is nothing left to evaluate
+	rolledBack := result.Phase == workloadv1alpha1.AnalysisPhaseFailed && spec.FailurePolicy == workloadv1alpha1.AnalysisFailurePolicyRollback
+
+	var requeueAfter time.Duration
+	if updated > 0 && !rolledBack {
+		interval := analysis.Interval(spec)
+		last := result.StartTime.Time
+		if result.LastEvaluationTime != nil {
+			last = result.LastEvaluationTime.Time
+		}
+		if wait := time.Until(last.Add(interval)); wait > 0 {
+			requeueAfter = wait
+		} else {
+			evaluated := r.AnalysisControl.Analyze(instance, currentRevision, updateRevision)
+			evaluated.StartTime = result.StartTime
+			result = evaluated
+			requeueAfter = interval
+		}
+	}
+	newStatus.Analysis = result
+
+	partition := desiredPartition(instance)
+	var gated int32
+	switch {
+	case result.Phase == workloadv1alpha1.AnalysisPhaseSuccessful:
+		return nil, requeueAfter
+	case result.Phase == workloadv1alpha1.AnalysisPhaseFailed && spec.FailurePolicy == workloadv1alpha1.AnalysisFailurePolicyRollback:
+		gated = 0
+	case result.Phase == workloadv1alpha1.AnalysisPhasePending:
+		gated = min(partition, max(updated, 1))
+	default:
+		gated = min(partition, updated)
+	}
+
+	klog.InfoS("---- rollout gate ----")
+	klog.InfoS("Rollout gated by analysis", "PartitionWorkload", klog.KObj(instance), "phase", result.Phase,
+		"desired partition", partition, "gated partition", gated)
+	return &gated, requeueAfter
+}
+
+// gateWebhooks gates the rollout on spec.gates. While any gate has not approved the update revision, no more
+// pods are moved to it. Gate answers are recorded in newStatus.
+func (r *PartitionWorkloadReconciler) gateWebhooks(
+	instance *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus,
+	currentRevision, updateRevision string, pods []*v1.Pod,
+) (*int32, time.Duration) {
+	if len(instance.Spec.Gates) == 0 || instance.Spec.Replicas == nil {
+		newStatus.Gates = nil
+		return nil, 0
+	}
+	// Keep the last answers around for inspection once the rollout is complete
+	newStatus.Gates = instance.Status.Gates
+	if currentRevision == updateRevision {
+		return nil, 0
+	}
+
+	gates, requeueAfter := r.GateControl.Evaluate(instance, currentRevision, updateRevision, pods)
+	newStatus.Gates = gates
+
+	var closed []string
+	for _, gate := range gates {
+		if gate.Phase != workloadv1alpha1.GatePhaseApproved {
+			closed = append(closed, gate.Name)
+		}
+	}
+	if len(closed) == 0 {
+		return nil, 0
+	}
+
+	partition := desiredPartition(instance)
+	gated := min(partition, countUpdated(pods, updateRevision))
+	klog.InfoS("---- rollout gate ----")
+	klog.InfoS("Rollout held by gates", "PartitionWorkload", klog.KObj(instance), "gates", closed,
+		"desired partition", partition, "gated partition", gated)
+	return &gated, requeueAfter
+}
+
+func countUpdated(pods []*v1.Pod, updateRevision string) int32 {
+	var updated int32
+	for _, pod := range pods {
+		if general.EqualToRevisionHash(pod, updateRevision) {
+			updated++
+		}
+	}
+	return updated
+}
+
+// desiredPartition returns spec.partition defaulted and clamped to spec.replicas, the same way pods are synced.
+func desiredPartition(instance *workloadv1alpha1.PartitionWorkload) int32 {
+	replicas := *instance.Spec.Replicas
+	if instance.Spec.Partition != nil && *instance.Spec.Partition < replicas {
+		return *instance.Spec.Partition
+	}
+	return replicas
+}
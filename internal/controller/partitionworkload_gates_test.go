@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+type fakeAnalysis struct {
+	phase workloadv1alpha1.AnalysisPhase
+	calls int
+}
+
+func (f *fakeAnalysis) Analyze(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string) *workloadv1alpha1.AnalysisStatus {
+	f.calls++
+	now := metav1.Now()
+	return &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: f.phase, LastEvaluationTime: &now}
+}
+
+type fakeGate struct {
+	phases map[string]workloadv1alpha1.GatePhase
+}
+
+func (f *fakeGate) Evaluate(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string, pods []*v1.Pod) ([]workloadv1alpha1.GateStatus, time.Duration) {
+	var statuses []workloadv1alpha1.GateStatus
+	var requeueAfter time.Duration
+	for _, gate := range pw.Spec.Gates {
+		statuses = append(statuses, workloadv1alpha1.GateStatus{Name: gate.Name, Revision: updateRevision, Phase: f.phases[gate.Name]})
+		if f.phases[gate.Name] != workloadv1alpha1.GatePhaseApproved {
+			requeueAfter = time.Second
+		}
+	}
+	return statuses, requeueAfter
+}
+
+func TestGatePartition(t *testing.T) {
+	const (
+		currentRevision = "test-pw-1111"
+		updateRevision  = "test-pw-2222"
+	)
+	longAgo := metav1.NewTime(time.Now().Add(-time.Hour))
+	justNow := metav1.Now()
+
+	tests := []struct {
+		name              string
+		failurePolicy     workloadv1alpha1.AnalysisFailurePolicy
+		status            *workloadv1alpha1.AnalysisStatus
+		updatedPods       int
+		updateRevision    string
+		analysisPhase     workloadv1alpha1.AnalysisPhase
+		expectedPartition *int32
+		expectedPhase     workloadv1alpha1.AnalysisPhase
+		expectedCalls     int
+	}{
+		{
+			name:              "Nothing to gate when the rollout is complete",
+			updateRevision:    currentRevision,
+			expectedPartition: nil,
+			expectedCalls:     0,
+		},
+		{
+			name:              "A new revision starts pending with a single canary pod",
+			updateRevision:    updateRevision,
+			expectedPartition: generalutil.Int32Ptr(1),
+			expectedPhase:     workloadv1alpha1.AnalysisPhasePending,
+			expectedCalls:     0,
+		},
+		{
+			name:              "Evaluation is not due before the interval elapses",
+			updateRevision:    updateRevision,
+			status:            &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhasePending, StartTime: &justNow},
+			updatedPods:       1,
+			expectedPartition: generalutil.Int32Ptr(1),
+			expectedPhase:     workloadv1alpha1.AnalysisPhasePending,
+			expectedCalls:     0,
+		},
+		{
+			name:              "Successful analysis uses spec.partition",
+			updateRevision:    updateRevision,
+			status:            &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhasePending, StartTime: &longAgo},
+			updatedPods:       1,
+			analysisPhase:     workloadv1alpha1.AnalysisPhaseSuccessful,
+			expectedPartition: nil,
+			expectedPhase:     workloadv1alpha1.AnalysisPhaseSuccessful,
+			expectedCalls:     1,
+		},
+		{
+			name:              "Inconclusive analysis holds the updated pods",
+			updateRevision:    updateRevision,
+			status:            &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhaseSuccessful, StartTime: &longAgo},
+			updatedPods:       2,
+			analysisPhase:     workloadv1alpha1.AnalysisPhaseInconclusive,
+			expectedPartition: generalutil.Int32Ptr(2),
+			expectedPhase:     workloadv1alpha1.AnalysisPhaseInconclusive,
+			expectedCalls:     1,
+		},
+		{
+			name:              "Failed analysis holds the updated pods",
+			updateRevision:    updateRevision,
+			failurePolicy:     workloadv1alpha1.AnalysisFailurePolicyHold,
+			status:            &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhaseSuccessful, StartTime: &longAgo},
+			updatedPods:       2,
+			analysisPhase:     workloadv1alpha1.AnalysisPhaseFailed,
+			expectedPartition: generalutil.Int32Ptr(2),
+			expectedPhase:     workloadv1alpha1.AnalysisPhaseFailed,
+			expectedCalls:     1,
+		},
+		{
+			name:              "Failed analysis rolls back with the Rollback policy",
+			updateRevision:    updateRevision,
+			failurePolicy:     workloadv1alpha1.AnalysisFailurePolicyRollback,
+			status:            &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhaseSuccessful, StartTime: &longAgo},
+			updatedPods:       2,
+			analysisPhase:     workloadv1alpha1.AnalysisPhaseFailed,
+			expectedPartition: generalutil.Int32Ptr(0),
+			expectedPhase:     workloadv1alpha1.AnalysisPhaseFailed,
+			expectedCalls:     1,
+		},
+		{
+			name:              "Rolled back revisions are not evaluated again",
+			updateRevision:    updateRevision,
+			failurePolicy:     workloadv1alpha1.AnalysisFailurePolicyRollback,
+			status:            &workloadv1alpha1.AnalysisStatus{Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhaseFailed, StartTime: &longAgo},
+			updatedPods:       0,
+			expectedPartition: generalutil.Int32Ptr(0),
+			expectedPhase:     workloadv1alpha1.AnalysisPhaseFailed,
+			expectedCalls:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw := newPW(testCurrentImage)
+			pw.Spec.Replicas = generalutil.Int32Ptr(4)
+			pw.Spec.Partition = generalutil.Int32Ptr(3)
+			pw.Spec.Analysis = &workloadv1alpha1.Analysis{
+				FailurePolicy: tt.failurePolicy,
+				Metrics:       []workloadv1alpha1.AnalysisMetric{{Name: "errors", Query: "errors"}},
+			}
+			pw.Status.Analysis = tt.status
+
+			var pods []*v1.Pod
+			for i := 0; i < 4; i++ {
+				hash := currentRevision
+				if i < tt.updatedPods {
+					hash = tt.updateRevision
+				}
+				pods = append(pods, newPod("pod", map[string]string{apps.ControllerRevisionHashLabelKey: hash}, pw))
+			}
+
+			fake := &fakeAnalysis{phase: tt.analysisPhase}
+			r := &PartitionWorkloadReconciler{AnalysisControl: fake}
+			newStatus := &workloadv1alpha1.PartitionWorkloadStatus{}
+
+			partition, _ := r.gatePartition(pw, newStatus, currentRevision, tt.updateRevision, pods)
+			if (partition == nil) != (tt.expectedPartition == nil) ||
+				(partition != nil && *partition != *tt.expectedPartition) {
+				t.Errorf("partition = %v, want %v", generalutil.DumpJSON(partition), generalutil.DumpJSON(tt.expectedPartition))
+			}
+			if fake.calls != tt.expectedCalls {
+				t.Errorf("Analyze called %d times, want %d", fake.calls, tt.expectedCalls)
+			}
+			if tt.expectedPhase != "" {
+				if newStatus.Analysis == nil || newStatus.Analysis.Phase != tt.expectedPhase {
+					t.Errorf("analysis status = %s, want phase %s", generalutil.DumpJSON(newStatus.Analysis), tt.expectedPhase)
+				}
+			}
+		})
+	}
+}
+
+func TestGatePartitionWebhooks(t *testing.T) {
+	const (
+		currentRevision = "test-pw-1111"
+		updateRevision  = "test-pw-2222"
+	)
+
+	tests := []struct {
+		name              string
+		phases            map[string]workloadv1alpha1.GatePhase
+		analysisPhase     workloadv1alpha1.AnalysisPhase
+		expectedPartition *int32
+		expectRequeue     bool
+	}{
+		{
+			name: "Approved gates use spec.partition",
+			phases: map[string]workloadv1alpha1.GatePhase{
+				"tests": workloadv1alpha1.GatePhaseApproved, "change": workloadv1alpha1.GatePhaseApproved,
+			},
+			expectedPartition: nil,
+		},
+		{
+			name: "A held gate holds the updated pods",
+			phases: map[string]workloadv1alpha1.GatePhase{
+				"tests": workloadv1alpha1.GatePhaseApproved, "change": workloadv1alpha1.GatePhaseHeld,
+			},
+			expectedPartition: generalutil.Int32Ptr(1),
+			expectRequeue:     true,
+		},
+		{
+			name: "An unreachable gate holds the updated pods",
+			phases: map[string]workloadv1alpha1.GatePhase{
+				"tests": workloadv1alpha1.GatePhasePending, "change": workloadv1alpha1.GatePhaseApproved,
+			},
+			expectedPartition: generalutil.Int32Ptr(1),
+			expectRequeue:     true,
+		},
+		{
+			name: "The most restrictive of analysis and gates wins",
+			phases: map[string]workloadv1alpha1.GatePhase{
+				"tests": workloadv1alpha1.GatePhaseApproved, "change": workloadv1alpha1.GatePhaseApproved,
+			},
+			analysisPhase:     workloadv1alpha1.AnalysisPhaseInconclusive,
+			expectedPartition: generalutil.Int32Ptr(1),
+			expectRequeue:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw := newPW(testCurrentImage)
+			pw.Spec.Replicas = generalutil.Int32Ptr(4)
+			pw.Spec.Partition = generalutil.Int32Ptr(3)
+			pw.Spec.Gates = []workloadv1alpha1.RolloutGate{
+				{Name: "tests", URL: "http://tests.example"},
+				{Name: "change", URL: "http://change.example"},
+			}
+			if tt.analysisPhase != "" {
+				longAgo := metav1.NewTime(time.Now().Add(-time.Hour))
+				pw.Spec.Analysis = &workloadv1alpha1.Analysis{
+					Metrics: []workloadv1alpha1.AnalysisMetric{{Name: "errors", Query: "errors"}},
+				}
+				pw.Status.Analysis = &workloadv1alpha1.AnalysisStatus{
+					Revision: updateRevision, Phase: workloadv1alpha1.AnalysisPhasePending, StartTime: &longAgo,
+				}
+			}
+
+			var pods []*v1.Pod
+			for i, hash := range []string{updateRevision, currentRevision, currentRevision, currentRevision} {
+				pods = append(pods, newPod(fmt.Sprintf("pod%d", i), map[string]string{apps.ControllerRevisionHashLabelKey: hash}, pw))
+			}
+
+			r := &PartitionWorkloadReconciler{
+				AnalysisControl: &fakeAnalysis{phase: tt.analysisPhase},
+				GateControl:     &fakeGate{phases: tt.phases},
+			}
+			newStatus := &workloadv1alpha1.PartitionWorkloadStatus{}
+
+			partition, requeueAfter := r.gatePartition(pw, newStatus, currentRevision, updateRevision, pods)
+			if (partition == nil) != (tt.expectedPartition == nil) ||
+				(partition != nil && *partition != *tt.expectedPartition) {
+				t.Errorf("partition = %v, want %v", generalutil.DumpJSON(partition), generalutil.DumpJSON(tt.expectedPartition))
+			}
+			if (requeueAfter > 0) != tt.expectRequeue {
+				t.Errorf("requeueAfter = %v, expect requeue %v", requeueAfter, tt.expectRequeue)
+			}
+			if len(newStatus.Gates) != len(pw.Spec.Gates) {
+				t.Errorf("recorded %d gate statuses, want %d", len(newStatus.Gates), len(pw.Spec.Gates))
+			}
+		})
+	}
+}
+
+func TestGatePartitionPaused(t *testing.T) {
+	const (
+		currentRevision = "test-pw-1111"
+		updateRevision  = "test-pw-2222"
+	)
+	pw := newPW(testCurrentImage)
+	pw.Spec.Replicas = generalutil.Int32Ptr(4)
+	pw.Spec.Partition = generalutil.Int32Ptr(3)
+	pw.Spec.Paused = true
+
+	var pods []*v1.Pod
+	for i, hash := range []string{updateRevision, currentRevision, currentRevision, currentRevision} {
+		pods = append(pods, newPod(fmt.Sprintf("pod%d", i), map[string]string{apps.ControllerRevisionHashLabelKey: hash}, pw))
+	}
+
+	r := &PartitionWorkloadReconciler{}
+	partition, _ := r.gatePartition(pw, &workloadv1alpha1.PartitionWorkloadStatus{}, currentRevision, updateRevision, pods)
+	if partition == nil || *partition != 1 {
+		t.Errorf("partition = %v, want 1", generalutil.DumpJSON(partition))
+	}
+
+	partition, _ = r.gatePartition(pw, &workloadv1alpha1.PartitionWorkloadStatus{}, updateRevision, updateRevision, pods)
+	if partition != nil {
+		t.Errorf("partition = %v, want nil once the rollout is complete", generalutil.DumpJSON(partition))
+	}
+}
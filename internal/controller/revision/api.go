@@ -2,8 +2,13 @@ package revision
 
 import (
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/config"
 	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	serializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/lru"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -11,16 +16,36 @@ type Interface interface {
 	NewRevision(instance *workloadv1alpha1.PartitionWorkload, revision int64, collisionCount *int32) (*apps.ControllerRevision, error)
 	getPatch(instance *workloadv1alpha1.PartitionWorkload) ([]byte, error)
 	ApplyRevision(instance *workloadv1alpha1.PartitionWorkload, revision *apps.ControllerRevision) (*workloadv1alpha1.PartitionWorkload, error)
+	ApplyCanaryOverrides(instance *workloadv1alpha1.PartitionWorkload) (*workloadv1alpha1.PartitionWorkload, error)
+	MatchRevision(instance *workloadv1alpha1.PartitionWorkload, pod *v1.Pod, revisions []*apps.ControllerRevision) (*apps.ControllerRevision, error)
+	DiffRevisions(instance *workloadv1alpha1.PartitionWorkload, from, to *apps.ControllerRevision) (*Diff, error)
 }
 
 type realRevision struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// codec encodes PartitionWorkloads for patching, it is built once as building it walks the whole scheme
+	codec runtime.Codec
+	// templates caches the pod templates restored from revisions by templateKey
+	templates *lru.Cache
+}
+
+// templateKey identifies the pod template restored from a revision for a generation of a PartitionWorkload. The UID
+// tells apart a PartitionWorkload recreated with the same name, which starts again at generation 1 and adopts the
+// revisions of the deleted one.
+type templateKey struct {
+	uid        types.UID
+	namespace  string
+	revision   string
+	generation int64
 }
 
 func NewRevisionControl(c client.Client, s *runtime.Scheme) Interface {
 	return &realRevision{
-		Client: c,
-		Scheme: s,
+		Client:    c,
+		Scheme:    s,
+		codec:     serializer.NewCodecFactory(s).LegacyCodec(workloadv1alpha1.SchemeGroupVersion),
+		templates: lru.New(config.RevisionCacheSize),
 	}
 }
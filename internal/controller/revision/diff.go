@@ -0,0 +1,353 @@
+package revision
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ChangeType is the kind of a difference between two pod templates
+type ChangeType string
+
+const (
+	// ChangeImage is a container whose image changed
+	ChangeImage ChangeType = "Image"
+	// ChangeEnv is an environment variable of a container that was added, removed or changed
+	ChangeEnv ChangeType = "Env"
+	// ChangeResources is a resource request or limit of a container that was added, removed or changed
+	ChangeResources ChangeType = "Resources"
+	// ChangeContainer is a container or init container that was added or removed
+	ChangeContainer ChangeType = "Container"
+	// ChangeMetadata is a label or annotation of the pod template that was added, removed or changed
+	ChangeMetadata ChangeType = "Metadata"
+	// ChangeField is any other field of the pod template that was added, removed or changed
+	ChangeField ChangeType = "Field"
+)
+
+// maxValueLength is the length beyond which values of other fields are cut short in a Change
+const maxValueLength = 64
+
+// Change is a single difference between the pod templates of two revisions
+type Change struct {
+	Type ChangeType
+	// Field is the path of the changed field in the pod template, with containers, env vars and map entries
+	// indexed by name, e.g. spec.containers[nginx].env[LOG_LEVEL]
+	Field string
+	// From is the value in the old template, empty if the field was added
+	From string
+	// To is the value in the new template, empty if the field was removed
+	To string
+}
+
+// String returns the change in a form short enough for event and condition messages,
+// e.g. "image nginx:1.25 → 1.27"
+func (c Change) String() string {
+	switch {
+	case c.Type == ChangeImage:
+		return fmt.Sprintf("image %s → %s", c.From, shortenImage(c.From, c.To))
+	case c.From == "":
+		return fmt.Sprintf("%s added: %s", c.Field, c.To)
+	case c.To == "":
+		return fmt.Sprintf("%s removed", c.Field)
+	default:
+		return fmt.Sprintf("%s: %s → %s", c.Field, c.From, c.To)
+	}
+}
+
+// Diff lists the differences between the pod templates of two revisions. Images come first,
+// then env vars, resources, containers, metadata and other fields.
+type Diff struct {
+	// From is the name of the old revision
+	From string
+	// To is the name of the new revision
+	To      string
+	Changes []Change
+}
+
+// String returns all changes separated by commas
+func (d *Diff) String() string {
+	return d.Summary(len(d.Changes))
+}
+
+// Summary returns at most max changes separated by commas, followed by the number of those left out
+func (d *Diff) Summary(max int) string {
+	if len(d.Changes) == 0 {
+		return "no changes to the pod template"
+	}
+	var parts []string
+	for i := 0; i < len(d.Changes) && i < max; i++ {
+		parts = append(parts, d.Changes[i].String())
+	}
+	if left := len(d.Changes) - len(parts); left > 0 {
+		parts = append(parts, fmt.Sprintf("and %d more", left))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DiffRevisions returns the differences between the pod templates that the two revisions restore
+// when applied to instance
+func (r *realRevision) DiffRevisions(instance *workloadv1alpha1.PartitionWorkload, from, to *apps.ControllerRevision) (*Diff, error) {
+	oldSet, err := r.ApplyRevision(instance, from)
+	if err != nil {
+		return nil, err
+	}
+	newSet, err := r.ApplyRevision(instance, to)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := DiffTemplates(&oldSet.Spec.Template, &newSet.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &Diff{From: from.Name, To: to.Name, Changes: changes}, nil
+}
+
+// DiffTemplates returns the differences between two pod templates, ordered by their type
+func DiffTemplates(from, to *v1.PodTemplateSpec) ([]Change, error) {
+	var changes []Change
+	changes = append(changes, diffStringMap("metadata.labels", from.Labels, to.Labels)...)
+	changes = append(changes, diffStringMap("metadata.annotations", from.Annotations, to.Annotations)...)
+
+	containerChanges, err := diffContainers("spec.initContainers", from.Spec.InitContainers, to.Spec.InitContainers)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, containerChanges...)
+	containerChanges, err = diffContainers("spec.containers", from.Spec.Containers, to.Spec.Containers)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, containerChanges...)
+
+	// Containers are compared by name above, everything else in the pod spec field by field
+	fromSpec, toSpec := from.Spec.DeepCopy(), to.Spec.DeepCopy()
+	fromSpec.Containers, fromSpec.InitContainers = nil, nil
+	toSpec.Containers, toSpec.InitContainers = nil, nil
+	fieldChanges, err := diffFields("spec", fromSpec, toSpec)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, fieldChanges...)
+
+	order := map[ChangeType]int{ChangeImage: 0, ChangeEnv: 1, ChangeResources: 2, ChangeContainer: 3, ChangeMetadata: 4, ChangeField: 5}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return order[changes[i].Type] < order[changes[j].Type]
+	})
+	return changes, nil
+}
+
+func diffContainers(path string, from, to []v1.Container) ([]Change, error) {
+	var changes []Change
+	toByName := make(map[string]*v1.Container, len(to))
+	for i := range to {
+		toByName[to[i].Name] = &to[i]
+	}
+	fromByName := make(map[string]*v1.Container, len(from))
+	for i := range from {
+		fromByName[from[i].Name] = &from[i]
+	}
+
+	for i := range from {
+		old := &from[i]
+		field := fmt.Sprintf("%s[%s]", path, old.Name)
+		updated, ok := toByName[old.Name]
+		if !ok {
+			changes = append(changes, Change{Type: ChangeContainer, Field: field, From: old.Image})
+			continue
+		}
+		if old.Image != updated.Image {
+			changes = append(changes, Change{Type: ChangeImage, Field: field + ".image", From: old.Image, To: updated.Image})
+		}
+		changes = append(changes, diffEnv(field, old.Env, updated.Env)...)
+		changes = append(changes, diffResources(field+".resources.requests", old.Resources.Requests, updated.Resources.Requests)...)
+		changes = append(changes, diffResources(field+".resources.limits", old.Resources.Limits, updated.Resources.Limits)...)
+
+		oldRest, updatedRest := old.DeepCopy(), updated.DeepCopy()
+		oldRest.Image, oldRest.Env, oldRest.Resources = "", nil, v1.ResourceRequirements{}
+		updatedRest.Image, updatedRest.Env, updatedRest.Resources = "", nil, v1.ResourceRequirements{}
+		fieldChanges, err := diffFields(field, oldRest, updatedRest)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, fieldChanges...)
+	}
+	for i := range to {
+		if _, ok := fromByName[to[i].Name]; !ok {
+			changes = append(changes, Change{Type: ChangeContainer, Field: fmt.Sprintf("%s[%s]", path, to[i].Name), To: to[i].Image})
+		}
+	}
+	return changes, nil
+}
+
+func diffEnv(container string, from, to []v1.EnvVar) []Change {
+	fromValues := make(map[string]string, len(from))
+	for _, env := range from {
+		fromValues[env.Name] = envValue(env)
+	}
+	toValues := make(map[string]string, len(to))
+	for _, env := range to {
+		toValues[env.Name] = envValue(env)
+	}
+	changes := diffStringMap(container+".env", fromValues, toValues)
+	for i := range changes {
+		changes[i].Type = ChangeEnv
+	}
+	return changes
+}
+
+// envValue describes the value of an env var, or where it comes from. Unset values are shown as "".
+func envValue(env v1.EnvVar) string {
+	source := env.ValueFrom
+	switch {
+	case source == nil:
+		return fmt.Sprintf("%q", env.Value)
+	case source.FieldRef != nil:
+		return "fieldRef " + source.FieldRef.FieldPath
+	case source.ResourceFieldRef != nil:
+		return "resourceFieldRef " + source.ResourceFieldRef.Resource
+	case source.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("configMapKeyRef %s/%s", source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key)
+	case source.SecretKeyRef != nil:
+		return fmt.Sprintf("secretKeyRef %s/%s", source.SecretKeyRef.Name, source.SecretKeyRef.Key)
+	default:
+		return "valueFrom"
+	}
+}
+
+func diffResources(path string, from, to v1.ResourceList) []Change {
+	fromValues := make(map[string]string, len(from))
+	for name, quantity := range from {
+		fromValues[string(name)] = quantity.String()
+	}
+	toValues := make(map[string]string, len(to))
+	for name, quantity := range to {
+		toValues[string(name)] = quantity.String()
+	}
+	changes := diffStringMap(path, fromValues, toValues)
+	for i := range changes {
+		changes[i].Type = ChangeResources
+	}
+	return changes
+}
+
+// diffStringMap compares two maps key by key, in the order of their keys
+func diffStringMap(path string, from, to map[string]string) []Change {
+	var changes []Change
+	for _, key := range unionKeys(from, to) {
+		oldValue, inOld := from[key]
+		newValue, inNew := to[key]
+		if inOld && inNew && oldValue == newValue {
+			continue
+		}
+		change := Change{Type: ChangeMetadata, Field: fmt.Sprintf("%s[%s]", path, key), From: oldValue, To: newValue}
+		// Keep empty values apart from missing ones
+		if inOld && oldValue == "" {
+			change.From = `""`
+		}
+		if inNew && newValue == "" {
+			change.To = `""`
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// diffFields compares the JSON fields of two objects of the same type one level deep
+func diffFields(path string, from, to interface{}) ([]Change, error) {
+	if reflect.DeepEqual(from, to) {
+		return nil, nil
+	}
+	fromFields, err := toFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := toFields(to)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	for _, key := range unionKeys(fromFields, toFields) {
+		if reflect.DeepEqual(fromFields[key], toFields[key]) {
+			continue
+		}
+		changes = append(changes, Change{
+			Type:  ChangeField,
+			Field: path + "." + key,
+			From:  formatValue(fromFields[key]),
+			To:    formatValue(toFields[key]),
+		})
+	}
+	return changes, nil
+}
+
+func toFields(obj interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// formatValue renders a JSON value compactly, cut short past maxValueLength
+func formatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	var s string
+	if str, ok := value.(string); ok {
+		s = str
+	} else {
+		data, _ := json.Marshal(value)
+		s = string(data)
+	}
+	if runes := []rune(s); len(runes) > maxValueLength {
+		s = string(runes[:maxValueLength]) + "…"
+	}
+	return s
+}
+
+func unionKeys[V any](from, to map[string]V) []string {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shortenImage drops the repository of the new image when it is the same as that of the old one,
+// so nginx:1.25 and nginx:1.27 read as nginx:1.25 → 1.27
+func shortenImage(from, to string) string {
+	fromRepo, _ := splitImage(from)
+	toRepo, version := splitImage(to)
+	if version != "" && fromRepo == toRepo {
+		return version
+	}
+	return to
+}
+
+// splitImage splits an image reference into its repository and its tag or digest
+func splitImage(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
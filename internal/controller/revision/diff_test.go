@@ -0,0 +1,129 @@
+package revision
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW()
+	pw.Spec.Template.Spec.Containers[0].Image = "nginx:1.25"
+	from, err := r.NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Spec.Template.Spec.Containers[0].Image = "nginx:1.27"
+	pw.Spec.Template.Spec.Containers[0].Env = []v1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}}
+	to, err := r.NewRevision(pw, 2, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := r.DiffRevisions(pw, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.From != from.Name || diff.To != to.Name {
+		t.Errorf("want diff from %s to %s got %s to %s", from.Name, to.Name, diff.From, diff.To)
+	}
+	if want := `image nginx:1.25 → 1.27, spec.containers[nginx].env[LOG_LEVEL] added: "debug"`; diff.String() != want {
+		t.Errorf("want %q got %q", want, diff.String())
+	}
+	if want := "image nginx:1.25 → 1.27, and 1 more"; diff.Summary(1) != want {
+		t.Errorf("want summary %q got %q", want, diff.Summary(1))
+	}
+
+	same, err := r.DiffRevisions(pw, to, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(same.Changes) != 0 || same.String() != "no changes to the pod template" {
+		t.Errorf("expected no changes, got %v", same.Changes)
+	}
+}
+
+func TestDiffTemplates(t *testing.T) {
+	from := &v1.PodTemplateSpec{Spec: v1.PodSpec{
+		Containers: []v1.Container{{
+			Name:  "app",
+			Image: "registry.example.com:5000/app:v1",
+			Env: []v1.EnvVar{
+				{Name: "REMOVED", Value: "x"},
+				{Name: "CHANGED", Value: "1"},
+			},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+			},
+			Args: []string{"--port=80"},
+		}, {
+			Name:  "sidecar",
+			Image: "envoy:1.30",
+		}},
+		NodeSelector: map[string]string{"disk": "ssd"},
+	}}
+	from.Labels = map[string]string{"app": "test", "tier": "web"}
+
+	to := from.DeepCopy()
+	to.Labels = map[string]string{"app": "test", "tier": ""}
+	to.Spec.Containers[0].Image = "other.example.com/app:v2"
+	to.Spec.Containers[0].Env = []v1.EnvVar{
+		{Name: "CHANGED", Value: "2"},
+		{Name: "SECRET", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "creds"}, Key: "token",
+		}}},
+	}
+	to.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("250m")
+	to.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")}
+	to.Spec.Containers[0].Args = []string{"--port=8080"}
+	to.Spec.Containers = append(to.Spec.Containers[:1], v1.Container{Name: "debug", Image: "busybox"})
+	to.Spec.NodeSelector = nil
+	to.Spec.PriorityClassName = "high"
+
+	changes, err := DiffTemplates(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"image registry.example.com:5000/app:v1 → other.example.com/app:v2",
+		`spec.containers[app].env[CHANGED]: "1" → "2"`,
+		"spec.containers[app].env[REMOVED] removed",
+		"spec.containers[app].env[SECRET] added: secretKeyRef creds/token",
+		"spec.containers[app].resources.requests[cpu]: 100m → 250m",
+		"spec.containers[app].resources.limits[memory] added: 128Mi",
+		"spec.containers[sidecar] removed",
+		"spec.containers[debug] added: busybox",
+		`metadata.labels[tier]: web → ""`,
+		`spec.containers[app].args: ["--port=80"] → ["--port=8080"]`,
+		`spec.nodeSelector removed`,
+		"spec.priorityClassName added: high",
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.String())
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want changes\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, repo, version string
+	}{
+		{image: "nginx", repo: "nginx"},
+		{image: "nginx:1.27", repo: "nginx", version: "1.27"},
+		{image: "localhost:5000/nginx", repo: "localhost:5000/nginx"},
+		{image: "localhost:5000/nginx:1.27", repo: "localhost:5000/nginx", version: "1.27"},
+		{image: "nginx@sha256:abc", repo: "nginx", version: "sha256:abc"},
+	}
+	for _, tt := range tests {
+		repo, version := splitImage(tt.image)
+		if repo != tt.repo || version != tt.version {
+			t.Errorf("%s: want %s and %s got %s and %s", tt.image, tt.repo, tt.version, repo, version)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package revision
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// stripIgnoredFields removes the fields listed in spec.revisionHashIgnore from the JSON of a pod template.
+// Label and annotation maps left empty are removed as well, so that ignoring the only annotation of a
+// template gives the same revision as a template without annotations.
+func stripIgnoredFields(template map[string]interface{}, ignore *workloadv1alpha1.RevisionHashIgnore) {
+	if ignore == nil {
+		return
+	}
+	if metadata, ok := template["metadata"].(map[string]interface{}); ok {
+		deleteKeys(metadata, "labels", ignore.Labels)
+		deleteKeys(metadata, "annotations", ignore.Annotations)
+	}
+	for _, path := range ignore.Paths {
+		tokens, err := ParsePointer(path)
+		if err != nil {
+			// Invalid paths are rejected by the webhook
+			continue
+		}
+		removePointer(template, tokens)
+	}
+}
+
+func deleteKeys(metadata map[string]interface{}, field string, keys []string) {
+	values, ok := metadata[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		delete(values, key)
+	}
+	if len(values) == 0 {
+		delete(metadata, field)
+	}
+}
+
+// restoreIgnoredFields sets the fields listed in spec.revisionHashIgnore of a template restored from a revision
+// to their values in the current template of pw, as revisions don't record them.
+func restoreIgnoredFields(template *v1.PodTemplateSpec, pw *workloadv1alpha1.PartitionWorkload) (*v1.PodTemplateSpec, error) {
+	ignore := pw.Spec.RevisionHashIgnore
+	if ignore == nil {
+		return template, nil
+	}
+	current := &pw.Spec.Template
+	restored := template.DeepCopy()
+	restored.Labels = copyKeys(restored.Labels, current.Labels, ignore.Labels)
+	restored.Annotations = copyKeys(restored.Annotations, current.Annotations, ignore.Annotations)
+	if len(ignore.Paths) == 0 {
+		return restored, nil
+	}
+
+	restoredFields, err := toFields(restored)
+	if err != nil {
+		return nil, err
+	}
+	currentFields, err := toFields(current)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range ignore.Paths {
+		tokens, err := ParsePointer(path)
+		if err != nil {
+			continue
+		}
+		if value, ok := getPointer(currentFields, tokens); ok {
+			setPointer(restoredFields, tokens, value)
+		} else {
+			removePointer(restoredFields, tokens)
+		}
+	}
+	data, err := json.Marshal(restoredFields)
+	if err != nil {
+		return nil, err
+	}
+	result := &v1.PodTemplateSpec{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// copyKeys sets the given keys of dst to their values in src, deleting those missing from src
+func copyKeys(dst, src map[string]string, keys []string) map[string]string {
+	for _, key := range keys {
+		if value, ok := src[key]; ok {
+			if dst == nil {
+				dst = map[string]string{}
+			}
+			dst[key] = value
+		} else {
+			delete(dst, key)
+		}
+	}
+	return dst
+}
+
+// IsMutablePodPath returns true if the reference tokens point at a pod field that can be updated in place, which
+// are the image of a container or init container, activeDeadlineSeconds and tolerations
+func IsMutablePodPath(tokens []string) bool {
+	if len(tokens) < 2 || tokens[0] != "spec" {
+		return false
+	}
+	switch len(tokens) {
+	case 2:
+		return tokens[1] == "activeDeadlineSeconds" || tokens[1] == "tolerations"
+	case 4:
+		index, err := strconv.Atoi(tokens[2])
+		return (tokens[1] == "containers" || tokens[1] == "initContainers") &&
+			err == nil && index >= 0 && strconv.Itoa(index) == tokens[2] && tokens[3] == "image"
+	}
+	return false
+}
+
+// ParsePointer splits a JSON pointer as defined by RFC 6901, e.g. /metadata/annotations/example.com~1id,
+// into its unescaped reference tokens
+func ParsePointer(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(token, "~0", ""), "~1", ""), "~") {
+			return nil, fmt.Errorf("JSON pointer %q has an invalid escape in %q", path, token)
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// getPointer returns the value the reference tokens point at in obj, descending into objects by key and
+// into arrays by index
+func getPointer(obj interface{}, tokens []string) (interface{}, bool) {
+	for _, token := range tokens {
+		switch typed := obj.(type) {
+		case map[string]interface{}:
+			value, ok := typed[token]
+			if !ok {
+				return nil, false
+			}
+			obj = value
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil, false
+			}
+			obj = typed[index]
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// setPointer sets the value the reference tokens point at in obj, if the object or array holding it exists.
+// Elements can only be replaced in arrays.
+func setPointer(obj interface{}, tokens []string, value interface{}) {
+	if len(tokens) == 0 {
+		return
+	}
+	parent, ok := getPointer(obj, tokens[:len(tokens)-1])
+	if !ok {
+		return
+	}
+	last := tokens[len(tokens)-1]
+	switch typed := parent.(type) {
+	case map[string]interface{}:
+		typed[last] = value
+	case []interface{}:
+		if index, err := strconv.Atoi(last); err == nil && index >= 0 && index < len(typed) {
+			typed[index] = value
+		}
+	}
+}
+
+// removePointer removes the object member the reference tokens point at in obj. Array elements are not removed,
+// as that would shift the ones after them.
+func removePointer(obj interface{}, tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	parent, ok := getPointer(obj, tokens[:len(tokens)-1])
+	if !ok {
+		return
+	}
+	if typed, ok := parent.(map[string]interface{}); ok {
+		delete(typed, tokens[len(tokens)-1])
+	}
+}
@@ -0,0 +1,114 @@
+package revision
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/controller/history"
+	"k8s.io/utils/ptr"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+func TestRevisionHashIgnore(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW()
+	pw.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{
+		Labels:      []string{"build"},
+		Annotations: []string{"ci.example.com/build-id"},
+		Paths:       []string{"/spec/activeDeadlineSeconds"},
+	}
+	pw.Spec.Template.Labels = map[string]string{"app": "test-app", "build": "1"}
+	pw.Spec.Template.Annotations = map[string]string{"ci.example.com/build-id": "1"}
+	pw.Spec.Template.Spec.ActiveDeadlineSeconds = ptr.To[int64](3600)
+	revision, err := r.NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing, adding or removing ignored fields gives the same revision
+	pw.Spec.Template.Labels["build"] = "2"
+	pw.Spec.Template.Annotations = nil
+	pw.Spec.Template.Spec.ActiveDeadlineSeconds = ptr.To[int64](1800)
+	pw.Generation++
+	changed, err := r.NewRevision(pw, 2, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history.EqualRevision(revision, changed) {
+		t.Errorf("ignored fields changed the revision: wanted %v got %v", string(revision.Data.Raw), string(changed.Data.Raw))
+	}
+
+	// Restored templates take the ignored fields from the current template
+	restored, err := r.ApplyRevision(pw, revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := restored.Spec.Template
+	if want := map[string]string{"app": "test-app", "build": "2"}; !reflect.DeepEqual(template.Labels, want) {
+		t.Errorf("want labels %v got %v", want, template.Labels)
+	}
+	if _, ok := template.Annotations["ci.example.com/build-id"]; ok {
+		t.Errorf("removed annotation was restored, got %v", template.Annotations)
+	}
+	if deadline := ptr.Deref(template.Spec.ActiveDeadlineSeconds, 0); deadline != 1800 {
+		t.Errorf("want active deadline 1800 got %d", deadline)
+	}
+
+	// Other fields still make up the revision
+	pw.Spec.Template.Spec.Containers[0].Image = "nginx:1.29"
+	updated, err := r.NewRevision(pw, 3, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.EqualRevision(revision, updated) {
+		t.Errorf("changing the image did not change the revision")
+	}
+}
+
+func TestIsMutablePodPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/spec/containers/0/image":            true,
+		"/spec/initContainers/1/image":        true,
+		"/spec/activeDeadlineSeconds":         true,
+		"/spec/tolerations":                   true,
+		"/spec/tolerations/0":                 false,
+		"/spec/containers/01/image":           false,
+		"/spec/containers/-1/image":           false,
+		"/spec/containers/0/env":              false,
+		"/spec/terminationGracePeriodSeconds": false,
+		"/metadata/labels/build":              false,
+	} {
+		tokens, err := ParsePointer(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := IsMutablePodPath(tokens); got != want {
+			t.Errorf("%s: want %v got %v", path, want, got)
+		}
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "/spec/terminationGracePeriodSeconds", want: []string{"spec", "terminationGracePeriodSeconds"}},
+		{path: "/metadata/annotations/example.com~1id", want: []string{"metadata", "annotations", "example.com/id"}},
+		{path: "/spec/containers/0/env/~01", want: []string{"spec", "containers", "0", "env", "~1"}},
+		{path: "spec/containers", wantErr: true},
+		{path: "/spec/a~2b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePointer(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: want error %v got %v", tt.path, tt.wantErr, err)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: want %q got %q", tt.path, tt.want, got)
+		}
+	}
+}
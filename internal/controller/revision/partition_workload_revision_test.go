@@ -5,7 +5,9 @@ import (
 	"reflect"
 	"testing"
 
+	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -34,7 +36,7 @@ func TestCreateApplyRevision(t *testing.T) {
 	if pw.Annotations == nil {
 		pw.Annotations = make(map[string]string)
 	}
-	key := "foo"
+	key := workloadv1alpha1.ChangeCauseAnnotationKey
 	expectedValue := "bar"
 	pw.Annotations[key] = expectedValue
 	restoredpw, err := r.ApplyRevision(pw, revision)
@@ -59,6 +61,27 @@ func TestCreateApplyRevision(t *testing.T) {
 	}
 }
 
+func TestNewRevisionAnnotations(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW()
+	pw.Annotations = map[string]string{
+		workloadv1alpha1.ChangeCauseAnnotationKey: "kubectl set image",
+		v1.LastAppliedConfigAnnotation:            `{"kind":"PartitionWorkload"}`,
+		workloadv1alpha1.CompletedAtAnnotationKey: "2024-01-01T00:00:00Z",
+		"example.com/team":                        "web",
+	}
+	revision, err := r.NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.Annotations[workloadv1alpha1.ChangeCauseAnnotationKey] != "kubectl set image" {
+		t.Errorf("missing change cause, got annotations %v", revision.Annotations)
+	}
+	if len(revision.Annotations) != 1 {
+		t.Errorf("want only the change cause to be copied, got annotations %v", revision.Annotations)
+	}
+}
+
 func TestApplyRevision(t *testing.T) {
 	r := newFakeControl()
 	pw := getPW()
@@ -92,11 +115,211 @@ func TestApplyRevision(t *testing.T) {
 	}
 }
 
+func TestApplyRevisionCache(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW()
+	revision, err := r.NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := r.ApplyRevision(pw, revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing what ApplyRevision returns must not change the cached template
+	restored.Spec.Template.Spec.Containers[0].Image = "busybox"
+	pw.Spec.Template.Spec.Containers[0].Image = "busybox"
+	cached, err := r.ApplyRevision(pw, revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := cached.Spec.Template.Spec.Containers[0].Image; image != "nginx" {
+		t.Errorf("want image nginx from the cache got %s", image)
+	}
+	if r.templates.Len() != 1 {
+		t.Errorf("want 1 cached template got %d", r.templates.Len())
+	}
+
+	pw.Generation++
+	if _, err := r.ApplyRevision(pw, revision); err != nil {
+		t.Fatal(err)
+	}
+	if r.templates.Len() != 2 {
+		t.Errorf("want a template cached for the new generation, got %d cached", r.templates.Len())
+	}
+
+	// A workload recreated with the same name starts again at generation 1 with the same revisions, but the
+	// fields left out of revisions come from its own template
+	recreated := getPW()
+	recreated.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{Labels: []string{"build"}}
+	recreated.Spec.Template.Labels = map[string]string{"build": "2"}
+	pw.Generation = recreated.Generation
+	pw.Spec.RevisionHashIgnore = recreated.Spec.RevisionHashIgnore
+	pw.Spec.Template.Labels = map[string]string{"build": "1"}
+	if _, err := r.ApplyRevision(pw, revision); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := r.ApplyRevision(recreated, revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build := applied.Spec.Template.Labels["build"]; build != "2" {
+		t.Errorf("want the build label of the recreated workload got %q", build)
+	}
+}
+
+func BenchmarkApplyRevision(b *testing.B) {
+	pw := getPW()
+	pw.Spec.Template.Spec.Containers[0].Env = []v1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}}
+	scheme := newFakeControl().Scheme
+	revision, err := NewRevisionControl(nil, scheme).NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Uncached does the work of every call before templates were cached, building a codec and patching
+	b.Run("Uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewRevisionControl(nil, scheme).ApplyRevision(pw, revision); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Cached", func(b *testing.B) {
+		r := newFakeControl()
+		for i := 0; i < b.N; i++ {
+			if _, err := r.ApplyRevision(pw, revision); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestApplyCanaryOverrides(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW()
+	revision, err := r.NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pw.Spec.CanaryOverrides = &runtime.RawExtension{Raw: []byte(
+		`{"metadata":{"labels":{"track":"canary"}},"spec":{"priorityClassName":"canary",` +
+			`"containers":[{"name":"nginx","env":[{"name":"DEBUG","value":"1"}]}]}}`,
+	)}
+
+	// The overrides must not change the revision
+	overriddenRevision, err := r.NewRevision(pw, 2, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history.EqualRevision(revision, overriddenRevision) {
+		t.Errorf("canary overrides changed the revision: wanted %v got %v", string(revision.Data.Raw), string(overriddenRevision.Data.Raw))
+	}
+
+	canary, err := r.ApplyCanaryOverrides(pw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := canary.Spec.Template.Annotations[workloadv1alpha1.CanaryOverridesAnnotationKey]; !ok {
+		t.Errorf("missing canary overrides annotation, got annotations %v", canary.Spec.Template.Annotations)
+	}
+	if canary.Spec.Template.Labels["track"] != "canary" {
+		t.Errorf("missing canary label, got labels %v", canary.Spec.Template.Labels)
+	}
+	if canary.Spec.Template.Spec.PriorityClassName != "canary" {
+		t.Errorf("want priority class canary got %q", canary.Spec.Template.Spec.PriorityClassName)
+	}
+	container := canary.Spec.Template.Spec.Containers[0]
+	if container.Image != "nginx" || len(container.Env) != 1 || container.Env[0].Name != "DEBUG" {
+		t.Errorf("containers are not merged by name, got %v", canary.Spec.Template.Spec.Containers)
+	}
+	if pw.Spec.Template.Labels != nil || pw.Spec.Template.Spec.PriorityClassName != "" {
+		t.Errorf("ApplyCanaryOverrides modified its input")
+	}
+
+	if _, err := PatchTemplate(&pw.Spec.Template, []byte(`{"spec":{"containers":"nginx"}}`)); err == nil {
+		t.Errorf("expected an error for an invalid patch")
+	}
+}
+
+func TestMatchRevision(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW()
+	first, err := r.NewRevision(pw, 1, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Spec.Template.Spec.Containers[0].Image = "nginx:1.29"
+	second, err := r.NewRevision(pw, 2, pw.Status.CollisionCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Spec.CanaryOverrides = &runtime.RawExtension{Raw: []byte(`{"spec":{"containers":[{"name":"nginx","image":"nginx:debug"}]}}`)}
+	revisions := []*apps.ControllerRevision{first, second}
+
+	newPod := func(image string, mutate ...func(*v1.PodSpec)) *v1.Pod {
+		pod := &v1.Pod{Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "nginx", Image: image, TerminationMessagePath: "/dev/termination-log"}},
+		}}
+		for _, m := range mutate {
+			m(&pod.Spec)
+		}
+		return pod
+	}
+	admitted := func(spec *v1.PodSpec) {
+		spec.NodeName = "node-1"
+		spec.ServiceAccountName = "default"
+		spec.Tolerations = []v1.Toleration{{Key: v1.TaintNodeNotReady, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute}}
+		spec.Volumes = []v1.Volume{{Name: "kube-api-access-x2k9q", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{}}}}
+		spec.Containers[0].VolumeMounts = []v1.VolumeMount{{Name: "kube-api-access-x2k9q", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"}}
+	}
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		want *apps.ControllerRevision
+	}{
+		{name: "Pod of the old revision", pod: newPod("nginx"), want: first},
+		{name: "Pod of the new revision", pod: newPod("nginx:1.29"), want: second},
+		{name: "Pod of the new revision mutated on admission", pod: newPod("nginx:1.29", admitted), want: second},
+		{name: "Pod with canary overrides", pod: newPod("nginx:debug"), want: second},
+		{name: "Pod of no revision", pod: newPod("busybox"), want: nil},
+		{name: "Pod with another env", pod: newPod("nginx:1.29", func(spec *v1.PodSpec) {
+			spec.Containers[0].Env = []v1.EnvVar{{Name: "DEBUG", Value: "1"}}
+		}), want: nil},
+		{name: "Pod with other resources", pod: newPod("nginx:1.29", func(spec *v1.PodSpec) {
+			spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}
+		}), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.MatchRevision(pw, tt.pod, revisions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want revision %v got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Images ignored by the revisions are updated in place, so pods still at the old image match
+	pw.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{Paths: []string{"/spec/containers/0/image"}}
+	if !PodMatchesTemplate(newPod("nginx:1.28"), &pw.Spec.Template, pw.Spec.RevisionHashIgnore) {
+		t.Errorf("expected a pod with an ignored image to match")
+	}
+	if PodMatchesTemplate(newPod("nginx:1.28", func(spec *v1.PodSpec) { spec.Containers[0].Args = []string{"-g"} }),
+		&pw.Spec.Template, pw.Spec.RevisionHashIgnore) {
+		t.Errorf("expected a pod with other args not to match")
+	}
+}
+
 func newFakeControl() *realRevision {
 	scheme := runtime.NewScheme()
 	utilruntime.Must(workloadv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(v1.AddToScheme(scheme))
-	return &realRevision{Scheme: scheme}
+	return NewRevisionControl(nil, scheme).(*realRevision)
 }
 
 func getPW() *workloadv1alpha1.PartitionWorkload {
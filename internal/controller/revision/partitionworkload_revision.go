@@ -2,15 +2,22 @@ package revision
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
 	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
-	serializer "k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	k8scorev1 "k8s.io/kubernetes/pkg/apis/core/v1"
 	"k8s.io/kubernetes/pkg/controller/history"
 )
 
+// serviceAccountVolumePrefix is the prefix of the name of the service account token volume added to pods
+const serviceAccountVolumePrefix = "kube-api-access-"
+
 func (r *realRevision) NewRevision(instance *workloadv1alpha1.PartitionWorkload, revision int64, collisionCount *int32) (*apps.ControllerRevision, error) {
 	patch, err := r.getPatch(instance)
 	if err != nil {
@@ -28,15 +35,16 @@ func (r *realRevision) NewRevision(instance *workloadv1alpha1.PartitionWorkload,
 	if cr.ObjectMeta.Annotations == nil {
 		cr.ObjectMeta.Annotations = make(map[string]string)
 	}
-	for key, value := range instance.Annotations {
-		cr.ObjectMeta.Annotations[key] = value
+	// Only the change cause is recorded. Other annotations of the PartitionWorkload, like the last applied
+	// configuration of kubectl, don't describe the revision and could clash with the ones the controller sets on it
+	if cause, ok := instance.Annotations[workloadv1alpha1.ChangeCauseAnnotationKey]; ok {
+		cr.ObjectMeta.Annotations[workloadv1alpha1.ChangeCauseAnnotationKey] = cause
 	}
 	return cr, nil
 }
 
 func (r *realRevision) getPatch(instance *workloadv1alpha1.PartitionWorkload) ([]byte, error) {
-	patchCodec := serializer.NewCodecFactory(r.Scheme).LegacyCodec(workloadv1alpha1.SchemeGroupVersion)
-	str, err := runtime.Encode(patchCodec, instance)
+	str, err := runtime.Encode(r.codec, instance)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +55,8 @@ func (r *realRevision) getPatch(instance *workloadv1alpha1.PartitionWorkload) ([
 	spec := raw["spec"].(map[string]interface{})
 	template := spec["template"].(map[string]interface{})
 
-	// Only patch the pod template
+	// Only patch the pod template, without the fields that don't make up revisions
+	stripIgnoredFields(template, instance.Spec.RevisionHashIgnore)
 	specCopy["template"] = template
 	template["$patch"] = "replace"
 	objCopy["spec"] = specCopy
@@ -55,10 +64,33 @@ func (r *realRevision) getPatch(instance *workloadv1alpha1.PartitionWorkload) ([
 	return patch, err
 }
 
+// ApplyRevision returns a copy of instance with the pod template restored from revision, and the fields listed in
+// spec.revisionHashIgnore taken from the current template. Restored templates are cached by revision and
+// generation of instance, as ApplyRevision runs several times in every reconcile.
 func (r *realRevision) ApplyRevision(instance *workloadv1alpha1.PartitionWorkload, revision *apps.ControllerRevision) (*workloadv1alpha1.PartitionWorkload, error) {
-	patchCodec := serializer.NewCodecFactory(r.Scheme).LegacyCodec(workloadv1alpha1.SchemeGroupVersion)
+	key := templateKey{uid: instance.UID, namespace: revision.Namespace, revision: revision.Name, generation: instance.Generation}
+	template, ok := r.templates.Get(key)
+	if !ok {
+		restored, err := r.restoreTemplate(instance, revision)
+		if err != nil {
+			return nil, err
+		}
+		if restored, err = restoreIgnoredFields(restored, instance); err != nil {
+			return nil, err
+		}
+		r.templates.Add(key, restored)
+		template = restored
+	}
+	clone := instance.DeepCopy()
+	// The cached template is shared, so hand out a copy
+	clone.Spec.Template = *template.(*v1.PodTemplateSpec).DeepCopy()
+	return clone, nil
+}
+
+// restoreTemplate patches instance with the data of revision and returns the resulting pod template
+func (r *realRevision) restoreTemplate(instance *workloadv1alpha1.PartitionWorkload, revision *apps.ControllerRevision) (*v1.PodTemplateSpec, error) {
 	clone := instance.DeepCopy()
-	cloneBytes, err := runtime.Encode(patchCodec, clone)
+	cloneBytes, err := runtime.Encode(r.codec, clone)
 	if err != nil {
 		return nil, err
 	}
@@ -70,5 +102,171 @@ func (r *realRevision) ApplyRevision(instance *workloadv1alpha1.PartitionWorkloa
 	if err := json.Unmarshal(patched, restoredSet); err != nil {
 		return nil, err
 	}
-	return restoredSet, nil
+	return &restoredSet.Spec.Template, nil
+}
+
+// ApplyCanaryOverrides returns a copy of instance whose pod template is patched with spec.canaryOverrides and
+// marked with the canary overrides annotation. The overrides are not part of any revision, so the result must
+// only be used to create pods.
+func (r *realRevision) ApplyCanaryOverrides(instance *workloadv1alpha1.PartitionWorkload) (*workloadv1alpha1.PartitionWorkload, error) {
+	if instance.Spec.CanaryOverrides == nil || len(instance.Spec.CanaryOverrides.Raw) == 0 {
+		return instance, nil
+	}
+	template, err := PatchTemplate(&instance.Spec.Template, instance.Spec.CanaryOverrides.Raw)
+	if err != nil {
+		return nil, err
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[workloadv1alpha1.CanaryOverridesAnnotationKey] = "true"
+	clone := instance.DeepCopy()
+	clone.Spec.Template = *template
+	return clone, nil
+}
+
+// MatchRevision returns the newest of the sorted revisions whose pod template the pod was created from, or nil
+// if there is none. Pods created with the canary overrides applied match as well.
+func (r *realRevision) MatchRevision(instance *workloadv1alpha1.PartitionWorkload, pod *v1.Pod, revisions []*apps.ControllerRevision) (
+	*apps.ControllerRevision, error,
+) {
+	ignore := instance.Spec.RevisionHashIgnore
+	for i := len(revisions) - 1; i >= 0; i-- {
+		applied, err := r.ApplyRevision(instance, revisions[i])
+		if err != nil {
+			return nil, err
+		}
+		if PodMatchesTemplate(pod, &applied.Spec.Template, ignore) {
+			return revisions[i], nil
+		}
+		canary, err := r.ApplyCanaryOverrides(applied)
+		if err != nil {
+			return nil, err
+		}
+		if canary != applied && PodMatchesTemplate(pod, &canary.Spec.Template, ignore) {
+			return revisions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// PodMatchesTemplate returns true if the spec of the pod is the one it gets when created from the template.
+// The template is defaulted the way the API server defaults pods, and the fields that admission plugins, the
+// scheduler or in place updates of the paths in ignore set on pods are taken from the pod.
+func PodMatchesTemplate(pod *v1.Pod, template *v1.PodTemplateSpec, ignore *workloadv1alpha1.RevisionHashIgnore) bool {
+	got := &v1.Pod{Spec: *pod.Spec.DeepCopy()}
+	k8scorev1.SetObjectDefaults_Pod(got)
+	removeServiceAccountVolumes(&got.Spec)
+	want := &v1.Pod{Spec: *template.Spec.DeepCopy()}
+	k8scorev1.SetObjectDefaults_Pod(want)
+
+	// Set by the scheduler and admission plugins
+	want.Spec.NodeName = got.Spec.NodeName
+	want.Spec.Priority = got.Spec.Priority
+	want.Spec.PreemptionPolicy = got.Spec.PreemptionPolicy
+	want.Spec.Overhead = got.Spec.Overhead
+	want.Spec.SchedulingGates = got.Spec.SchedulingGates
+	want.Spec.EphemeralContainers = got.Spec.EphemeralContainers
+	if want.Spec.ServiceAccountName == "" {
+		want.Spec.ServiceAccountName = got.Spec.ServiceAccountName
+		want.Spec.DeprecatedServiceAccount = got.Spec.DeprecatedServiceAccount
+	}
+	if len(want.Spec.ImagePullSecrets) == 0 {
+		want.Spec.ImagePullSecrets = got.Spec.ImagePullSecrets
+	}
+	// Tolerations are only ever added to pods
+	if containsTolerations(got.Spec.Tolerations, want.Spec.Tolerations) {
+		want.Spec.Tolerations = got.Spec.Tolerations
+	}
+
+	// Updated in place from the current template
+	if ignore != nil {
+		for _, path := range ignore.Paths {
+			tokens, err := ParsePointer(path)
+			if err != nil || !IsMutablePodPath(tokens) {
+				continue
+			}
+			switch tokens[1] {
+			case "activeDeadlineSeconds":
+				want.Spec.ActiveDeadlineSeconds = got.Spec.ActiveDeadlineSeconds
+			case "tolerations":
+				want.Spec.Tolerations = got.Spec.Tolerations
+			case "containers":
+				copyImage(want.Spec.Containers, got.Spec.Containers, tokens[2])
+			case "initContainers":
+				copyImage(want.Spec.InitContainers, got.Spec.InitContainers, tokens[2])
+			}
+		}
+	}
+	return apiequality.Semantic.DeepEqual(want.Spec, got.Spec)
+}
+
+// removeServiceAccountVolumes removes the projected service account token volume the ServiceAccount admission
+// plugin adds to pods, and its mounts
+func removeServiceAccountVolumes(spec *v1.PodSpec) {
+	removed := map[string]bool{}
+	var volumes []v1.Volume
+	for _, volume := range spec.Volumes {
+		if strings.HasPrefix(volume.Name, serviceAccountVolumePrefix) && volume.Projected != nil {
+			removed[volume.Name] = true
+			continue
+		}
+		volumes = append(volumes, volume)
+	}
+	if len(removed) == 0 {
+		return
+	}
+	spec.Volumes = volumes
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			var mounts []v1.VolumeMount
+			for _, mount := range containers[i].VolumeMounts {
+				if !removed[mount.Name] {
+					mounts = append(mounts, mount)
+				}
+			}
+			containers[i].VolumeMounts = mounts
+		}
+	}
+}
+
+func containsTolerations(tolerations, wanted []v1.Toleration) bool {
+	for i := range wanted {
+		found := false
+		for j := range tolerations {
+			if apiequality.Semantic.DeepEqual(tolerations[j], wanted[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// copyImage sets the image of the container at the given index of dst to the one of src, if both have it
+func copyImage(dst, src []v1.Container, index string) {
+	i, _ := strconv.Atoi(index)
+	if i < len(dst) && i < len(src) && dst[i].Name == src[i].Name {
+		dst[i].Image = src[i].Image
+	}
+}
+
+// PatchTemplate applies a strategic merge patch to a pod template
+func PatchTemplate(template *v1.PodTemplateSpec, patch []byte) (*v1.PodTemplateSpec, error) {
+	original, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, patch, &v1.PodTemplateSpec{})
+	if err != nil {
+		return nil, err
+	}
+	result := &v1.PodTemplateSpec{}
+	if err := json.Unmarshal(patched, result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
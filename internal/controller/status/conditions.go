@@ -0,0 +1,83 @@
+package status
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
+)
+
+// calculateConditions sets the Available, Progressing and RolloutComplete conditions of newStatus from the
+// replica counts already calculated. ReplicaFailure and FailedScale are maintained by the sync of pods.
+//
+// Parameters:
+// - pw: the PartitionWorkload being reconciled
+// - newStatus: the status with replica counts and revisions calculated
+func calculateConditions(pw *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus) {
+	replicas := *pw.Spec.Replicas
+	partition := replicas
+	if pw.Spec.Partition != nil && *pw.Spec.Partition < replicas {
+		partition = *pw.Spec.Partition
+	}
+	generation := pw.Generation
+	complete := newStatus.CurrentRevision == newStatus.UpdateRevision
+
+	available := fmt.Sprintf("%d of %d replicas are available", newStatus.AvailableReplicas, replicas)
+	if newStatus.AvailableReplicas >= replicas {
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionAvailable, metav1.ConditionTrue, generation,
+			workloadv1alpha1.ReasonMinimumReplicasAvailable, available,
+		))
+	} else {
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionAvailable, metav1.ConditionFalse, generation,
+			workloadv1alpha1.ReasonMinimumReplicasUnavailable, available,
+		))
+	}
+
+	// The partition is reached once every desired replica is ready and the pods at the update revision match
+	// the partition, or all pods are at the update revision
+	reached := newStatus.Replicas == replicas && newStatus.ReadyReplicas >= replicas &&
+		(complete || newStatus.UpdatedReplicas == partition)
+	progress := fmt.Sprintf("%d of %d replicas are at revision %s, partition is %d",
+		newStatus.UpdatedReplicas, replicas, newStatus.UpdateRevision, partition)
+	analysis := newStatus.Analysis
+
+	switch {
+	case !complete && analysis != nil && analysis.Revision == newStatus.UpdateRevision &&
+		analysis.Phase == workloadv1alpha1.AnalysisPhaseFailed:
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionProgressing, metav1.ConditionFalse, generation,
+			workloadv1alpha1.ReasonAnalysisFailed, fmt.Sprintf("analysis of revision %s failed", newStatus.UpdateRevision),
+		))
+	case reached:
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionProgressing, metav1.ConditionTrue, generation,
+			workloadv1alpha1.ReasonPartitionReached, progress,
+		))
+	case pw.Spec.Paused && !complete:
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionProgressing, metav1.ConditionUnknown, generation,
+			workloadv1alpha1.ReasonRolloutPaused, progress,
+		))
+	default:
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionProgressing, metav1.ConditionTrue, generation,
+			workloadv1alpha1.ReasonReplicasUpdating, progress,
+		))
+	}
+
+	if complete && reached {
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionRolloutComplete, metav1.ConditionTrue, generation,
+			workloadv1alpha1.ReasonRolloutComplete, fmt.Sprintf("all replicas are ready at revision %s", newStatus.UpdateRevision),
+		))
+	} else {
+		condition.SetCondition(newStatus, condition.NewCondition(
+			workloadv1alpha1.PartitionWorkloadConditionRolloutComplete, metav1.ConditionFalse, generation,
+			workloadv1alpha1.ReasonRolloutInProgress, progress,
+		))
+	}
+}
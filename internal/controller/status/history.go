@@ -0,0 +1,86 @@
+package status
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/controller/history"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
+)
+
+// recordRevisionCompletion stamps the update revision with the time and number of replicas of a rollout to it
+// that has just completed, i.e. whose RolloutComplete condition has just become True. The patched revision
+// replaces the original one in revisions.
+//
+// Parameters:
+// - pw: the PartitionWorkload being reconciled, holding the previous status
+// - newStatus: the status with conditions calculated
+// - revisions: the revisions of pw, including the update revision
+//
+// Returns:
+// - error: any error encountered while patching the revision
+func (r *realStatusUpdater) recordRevisionCompletion(pw *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus,
+	revisions []*apps.ControllerRevision,
+) error {
+	complete := condition.GetCondition(*newStatus, workloadv1alpha1.PartitionWorkloadConditionRolloutComplete)
+	if complete == nil || complete.Status != metav1.ConditionTrue {
+		return nil
+	}
+	for i, revision := range revisions {
+		if revision.Name != newStatus.UpdateRevision {
+			continue
+		}
+		wasComplete := condition.GetCondition(pw.Status, workloadv1alpha1.PartitionWorkloadConditionRolloutComplete)
+		_, recorded := revision.Annotations[workloadv1alpha1.CompletedAtAnnotationKey]
+		if recorded && pw.Status.UpdateRevision == newStatus.UpdateRevision &&
+			wasComplete != nil && wasComplete.Status == metav1.ConditionTrue {
+			return nil
+		}
+
+		updated := revision.DeepCopy()
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[workloadv1alpha1.CompletedAtAnnotationKey] = time.Now().UTC().Format(time.RFC3339)
+		updated.Annotations[workloadv1alpha1.CompletedReplicasAnnotationKey] = strconv.Itoa(int(newStatus.Replicas))
+		if err := r.Patch(context.TODO(), updated, client.MergeFrom(revision)); err != nil {
+			return err
+		}
+		klog.InfoS("Recorded the completion of the rollout", "PartitionWorkload", klog.KObj(pw), "revision", revision.Name)
+		revisions[i] = updated
+		return nil
+	}
+	return nil
+}
+
+// calculateRevisionHistory summarizes the revisions, oldest first, from their metadata
+func calculateRevisionHistory(revisions []*apps.ControllerRevision) []workloadv1alpha1.RevisionHistoryEntry {
+	sorted := append([]*apps.ControllerRevision(nil), revisions...)
+	history.SortControllerRevisions(sorted)
+
+	entries := make([]workloadv1alpha1.RevisionHistoryEntry, 0, len(sorted))
+	for _, revision := range sorted {
+		entry := workloadv1alpha1.RevisionHistoryEntry{
+			Name:         revision.Name,
+			Revision:     revision.Revision,
+			ChangeCause:  revision.Annotations[workloadv1alpha1.ChangeCauseAnnotationKey],
+			CreationTime: revision.CreationTimestamp,
+		}
+		if completedAt, err := time.Parse(time.RFC3339, revision.Annotations[workloadv1alpha1.CompletedAtAnnotationKey]); err == nil {
+			entry.CompletionTime = &metav1.Time{Time: completedAt}
+		}
+		if replicas, err := strconv.ParseInt(revision.Annotations[workloadv1alpha1.CompletedReplicasAnnotationKey], 10, 32); err == nil {
+			entry.Replicas = ptr.To(int32(replicas))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,139 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
+)
+
+func TestRecordRevisionCompletion(t *testing.T) {
+	completed := condition.NewCondition(workloadv1alpha1.PartitionWorkloadConditionRolloutComplete, metav1.ConditionTrue, 1,
+		workloadv1alpha1.ReasonRolloutComplete, "")
+	inProgress := condition.NewCondition(workloadv1alpha1.PartitionWorkloadConditionRolloutComplete, metav1.ConditionFalse, 1,
+		workloadv1alpha1.ReasonRolloutInProgress, "")
+	earlier := "2020-01-01T00:00:00Z"
+
+	tests := []struct {
+		name         string
+		oldCondition workloadv1alpha1.PartitionWorkloadCondition
+		newCondition workloadv1alpha1.PartitionWorkloadCondition
+		completedAt  string
+		wantRecorded bool
+	}{
+		{
+			name:         "Rollout in progress",
+			oldCondition: inProgress,
+			newCondition: inProgress,
+		},
+		{
+			name:         "Rollout just completed",
+			oldCondition: inProgress,
+			newCondition: completed,
+			wantRecorded: true,
+		},
+		{
+			name:         "Rollout back to a revision that completed before",
+			oldCondition: inProgress,
+			newCondition: completed,
+			completedAt:  earlier,
+			wantRecorded: true,
+		},
+		{
+			name:         "Rollout completed earlier",
+			oldCondition: completed,
+			newCondition: completed,
+			completedAt:  earlier,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revision := &apps.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: newRevision}, Revision: 2}
+			if tt.completedAt != "" {
+				revision.Annotations = map[string]string{
+					workloadv1alpha1.CompletedAtAnnotationKey:       tt.completedAt,
+					workloadv1alpha1.CompletedReplicasAnnotationKey: "1",
+				}
+			}
+			scheme := runtime.NewScheme()
+			utilruntime.Must(apps.AddToScheme(scheme))
+			r := &realStatusUpdater{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(revision).Build()}
+
+			pw := getPW(3)
+			pw.Status.UpdateRevision = newRevision
+			pw.Status.Conditions = []workloadv1alpha1.PartitionWorkloadCondition{tt.oldCondition}
+			newStatus := &workloadv1alpha1.PartitionWorkloadStatus{
+				Replicas:       3,
+				UpdateRevision: newRevision,
+				Conditions:     []workloadv1alpha1.PartitionWorkloadCondition{tt.newCondition},
+			}
+			revisions := []*apps.ControllerRevision{revision}
+			if err := r.recordRevisionCompletion(pw, newStatus, revisions); err != nil {
+				t.Fatal(err)
+			}
+
+			stored := &apps.ControllerRevision{}
+			if err := r.Get(context.TODO(), client.ObjectKeyFromObject(revision), stored); err != nil {
+				t.Fatal(err)
+			}
+			completedAt := stored.Annotations[workloadv1alpha1.CompletedAtAnnotationKey]
+			if recorded := completedAt != tt.completedAt; recorded != tt.wantRecorded {
+				t.Fatalf("expected completion to be recorded: %v, got completed-at %q", tt.wantRecorded, completedAt)
+			}
+			if tt.wantRecorded && stored.Annotations[workloadv1alpha1.CompletedReplicasAnnotationKey] != "3" {
+				t.Errorf("expected 3 completed replicas, got annotations %v", stored.Annotations)
+			}
+			if revisions[0].Annotations[workloadv1alpha1.CompletedAtAnnotationKey] != completedAt {
+				t.Errorf("the revision was not replaced by its patched version")
+			}
+		})
+	}
+}
+
+func TestCalculateRevisionHistory(t *testing.T) {
+	created := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	revisions := []*apps.ControllerRevision{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              newRevision,
+				CreationTimestamp: created,
+				Annotations:       map[string]string{workloadv1alpha1.ChangeCauseAnnotationKey: "kubectl set image"},
+			},
+			Revision: 2,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              currentRevision,
+				CreationTimestamp: created,
+				Annotations: map[string]string{
+					workloadv1alpha1.CompletedAtAnnotationKey:       "2026-01-02T00:00:00Z",
+					workloadv1alpha1.CompletedReplicasAnnotationKey: "3",
+				},
+			},
+			Revision: 1,
+		},
+	}
+
+	entries := calculateRevisionHistory(revisions)
+	if len(entries) != 2 || entries[0].Name != currentRevision || entries[1].Name != newRevision {
+		t.Fatalf("expected the entries oldest first, got %+v", entries)
+	}
+	if entries[0].CompletionTime == nil || !entries[0].CompletionTime.Equal(&metav1.Time{Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)}) ||
+		entries[0].Replicas == nil || *entries[0].Replicas != 3 {
+		t.Errorf("expected the completion of revision 1, got %+v", entries[0])
+	}
+	if entries[1].ChangeCause != "kubectl set image" || entries[1].CompletionTime != nil || entries[1].Replicas != nil ||
+		!entries[1].CreationTime.Equal(&created) {
+		t.Errorf("unexpected entry for revision 2: %+v", entries[1])
+	}
+}
@@ -5,18 +5,28 @@ import (
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
 	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
 )
 
-func (r *realStatusUpdater) UpdateStatus(pw *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus, pods []*v1.Pod) error {
+func (r *realStatusUpdater) UpdateStatus(pw *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus, pods []*v1.Pod,
+	revisions []*apps.ControllerRevision,
+) error {
 	r.calculateStatus(pw, newStatus, pods)
+	if err := r.recordRevisionCompletion(pw, newStatus, revisions); err != nil {
+		return err
+	}
+	newStatus.RevisionHistory = calculateRevisionHistory(revisions)
 	if !r.inconsistentStatus(pw, newStatus) {
 		return nil
 	}
-	klog.InfoS("To update PartitionWorkload status", "PartitionWorkload", klog.KObj(pw), "replicas", newStatus.Replicas, "updated replicas", newStatus.UpdatedReplicas,
+	klog.InfoS("To update PartitionWorkload status", "PartitionWorkload", klog.KObj(pw), "replicas", newStatus.Replicas, "ready replicas", newStatus.ReadyReplicas, "updated replicas", newStatus.UpdatedReplicas,
 		"currentRevision", newStatus.CurrentRevision, "updateRevision", newStatus.UpdateRevision)
 	return r.commitStatusUpdate(pw, newStatus)
 }
@@ -33,23 +43,53 @@ func (r *realStatusUpdater) commitStatusUpdate(pw *workloadv1alpha1.PartitionWor
 }
 
 func (r *realStatusUpdater) calculateStatus(pw *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus, pods []*v1.Pod) {
+	// The scale subresource reads the selector from status, where it has to be a string
+	if selector, err := metav1.LabelSelectorAsSelector(pw.Spec.Selector); err == nil {
+		newStatus.LabelSelector = selector.String()
+	}
+	now := metav1.Now()
 	for _, pod := range pods {
 		newStatus.Replicas++
+		ready := podutil.IsPodReady(pod)
+		if ready {
+			newStatus.ReadyReplicas++
+		}
+		if podutil.IsPodAvailable(pod, pw.Spec.MinReadySeconds, now) {
+			newStatus.AvailableReplicas++
+		}
+		if generalutil.EqualToRevisionHash(pod, newStatus.CurrentRevision) {
+			newStatus.CurrentReplicas++
+		}
 		if generalutil.EqualToRevisionHash(pod, newStatus.UpdateRevision) {
 			newStatus.UpdatedReplicas++
+			if ready {
+				newStatus.UpdatedReadyReplicas++
+			}
 		}
 	}
 	// Consider update revision to be stable and set current revision as it if all replicas are at update revision (full rollout)
 	if newStatus.UpdatedReplicas == newStatus.Replicas && newStatus.Replicas == *pw.Spec.Replicas {
 		newStatus.CurrentRevision = newStatus.UpdateRevision
+		newStatus.CurrentReplicas = newStatus.UpdatedReplicas
 	}
+
+	calculateConditions(pw, newStatus)
 }
 
 func (r *realStatusUpdater) inconsistentStatus(pw *workloadv1alpha1.PartitionWorkload, newStatus *workloadv1alpha1.PartitionWorkloadStatus) bool {
 	oldStatus := pw.Status
 	return newStatus.ObservedGeneration > oldStatus.ObservedGeneration ||
 		newStatus.Replicas != oldStatus.Replicas ||
+		newStatus.ReadyReplicas != oldStatus.ReadyReplicas ||
+		newStatus.AvailableReplicas != oldStatus.AvailableReplicas ||
+		newStatus.CurrentReplicas != oldStatus.CurrentReplicas ||
 		newStatus.UpdatedReplicas != oldStatus.UpdatedReplicas ||
+		newStatus.UpdatedReadyReplicas != oldStatus.UpdatedReadyReplicas ||
 		newStatus.UpdateRevision != oldStatus.UpdateRevision ||
-		newStatus.CurrentRevision != oldStatus.CurrentRevision
+		newStatus.CurrentRevision != oldStatus.CurrentRevision ||
+		newStatus.LabelSelector != oldStatus.LabelSelector ||
+		!apiequality.Semantic.DeepEqual(newStatus.Analysis, oldStatus.Analysis) ||
+		!apiequality.Semantic.DeepEqual(newStatus.Gates, oldStatus.Gates) ||
+		!apiequality.Semantic.DeepEqual(newStatus.Conditions, oldStatus.Conditions) ||
+		!apiequality.Semantic.DeepEqual(newStatus.RevisionHistory, oldStatus.RevisionHistory)
 }
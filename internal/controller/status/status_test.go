@@ -2,11 +2,14 @@ package status
 
 import (
 	"testing"
+	"time"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
 	sync "github.com/2170chm/k8s-partition-workload/internal/controller/sync"
 	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -100,6 +103,189 @@ func TestCalculateStatus(t *testing.T) {
 	}
 }
 
+func TestCalculateStatusCounters(t *testing.T) {
+	pw := getPW(4)
+	pw.Spec.MinReadySeconds = 30
+	longAgo := metav1.NewTime(time.Now().Add(-time.Minute))
+	justNow := metav1.Now()
+
+	pods := flatten(
+		sync.NewVersionedPods(pw, currentRevision, 2),
+		sync.NewVersionedPods(pw, newRevision, 1),
+		sync.NewVersionedPods(pw, "0", 1),
+	)
+	readySince(pods[0], longAgo)
+	readySince(pods[2], justNow)
+	readySince(pods[3], longAgo)
+
+	updater := &realStatusUpdater{}
+	newStatus := &workloadv1alpha1.PartitionWorkloadStatus{
+		CurrentRevision: currentRevision,
+		UpdateRevision:  newRevision,
+	}
+	updater.calculateStatus(pw, newStatus, pods)
+
+	expected := workloadv1alpha1.PartitionWorkloadStatus{
+		Replicas:             4,
+		ReadyReplicas:        3,
+		AvailableReplicas:    2,
+		CurrentReplicas:      2,
+		UpdatedReplicas:      1,
+		UpdatedReadyReplicas: 1,
+	}
+	if newStatus.Replicas != expected.Replicas || newStatus.ReadyReplicas != expected.ReadyReplicas ||
+		newStatus.AvailableReplicas != expected.AvailableReplicas || newStatus.CurrentReplicas != expected.CurrentReplicas ||
+		newStatus.UpdatedReplicas != expected.UpdatedReplicas || newStatus.UpdatedReadyReplicas != expected.UpdatedReadyReplicas {
+		t.Errorf("counters = %s, want %s", generalutil.DumpJSON(newStatus), generalutil.DumpJSON(expected))
+	}
+
+	pw.Status = *newStatus.DeepCopy()
+	pw.Status.AvailableReplicas = 3
+	if !updater.inconsistentStatus(pw, newStatus) {
+		t.Errorf("a changed available count should trigger a status update")
+	}
+}
+
+func readySince(pod *v1.Pod, since metav1.Time) {
+	pod.Status.Conditions = append(pod.Status.Conditions,
+		v1.PodCondition{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: since})
+}
+
+func TestCalculateStatusLabelSelector(t *testing.T) {
+	pw := getPW(1)
+	pw.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{"app": "test-app"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"backend"}},
+		},
+	}
+	updater := &realStatusUpdater{}
+	newStatus := &workloadv1alpha1.PartitionWorkloadStatus{}
+
+	updater.calculateStatus(pw, newStatus, nil)
+
+	if expected := "app=test-app,tier in (backend)"; newStatus.LabelSelector != expected {
+		t.Errorf("LabelSelector = %q, want %q", newStatus.LabelSelector, expected)
+	}
+	if !updater.inconsistentStatus(pw, newStatus) {
+		t.Errorf("a new label selector should trigger a status update")
+	}
+}
+
+func TestCalculateConditions(t *testing.T) {
+	tests := []struct {
+		name             string
+		pw               *workloadv1alpha1.PartitionWorkload
+		pods             []*v1.Pod
+		analysis         *workloadv1alpha1.AnalysisStatus
+		expectedStatuses map[string]metav1.ConditionStatus
+		expectedReason   string
+	}{
+		{
+			name: "Complete rollout with ready pods",
+			pw:   getPW(2),
+			pods: ready(sync.NewVersionedPods(getPW(2), newRevision, 2)...),
+			expectedStatuses: map[string]metav1.ConditionStatus{
+				workloadv1alpha1.PartitionWorkloadConditionAvailable:       metav1.ConditionTrue,
+				workloadv1alpha1.PartitionWorkloadConditionProgressing:     metav1.ConditionTrue,
+				workloadv1alpha1.PartitionWorkloadConditionRolloutComplete: metav1.ConditionTrue,
+			},
+			expectedReason: workloadv1alpha1.ReasonPartitionReached,
+		},
+		{
+			name: "Pods that are not ready are unavailable",
+			pw:   getPW(2),
+			pods: flatten(ready(sync.NewVersionedPods(getPW(2), newRevision, 1)...), sync.NewVersionedPods(getPW(2), newRevision, 1)),
+			expectedStatuses: map[string]metav1.ConditionStatus{
+				workloadv1alpha1.PartitionWorkloadConditionAvailable:       metav1.ConditionFalse,
+				workloadv1alpha1.PartitionWorkloadConditionProgressing:     metav1.ConditionTrue,
+				workloadv1alpha1.PartitionWorkloadConditionRolloutComplete: metav1.ConditionFalse,
+			},
+			expectedReason: workloadv1alpha1.ReasonReplicasUpdating,
+		},
+		{
+			name: "Reached partition of a partial rollout",
+			pw:   withPartition(getPW(3), 1),
+			pods: ready(flatten(sync.NewVersionedPods(getPW(3), currentRevision, 2), sync.NewVersionedPods(getPW(3), newRevision, 1))...),
+			expectedStatuses: map[string]metav1.ConditionStatus{
+				workloadv1alpha1.PartitionWorkloadConditionAvailable:       metav1.ConditionTrue,
+				workloadv1alpha1.PartitionWorkloadConditionProgressing:     metav1.ConditionTrue,
+				workloadv1alpha1.PartitionWorkloadConditionRolloutComplete: metav1.ConditionFalse,
+			},
+			expectedReason: workloadv1alpha1.ReasonPartitionReached,
+		},
+		{
+			name: "Paused rollout",
+			pw:   paused(getPW(3)),
+			pods: ready(flatten(sync.NewVersionedPods(getPW(3), currentRevision, 2), sync.NewVersionedPods(getPW(3), newRevision, 1))...),
+			expectedStatuses: map[string]metav1.ConditionStatus{
+				workloadv1alpha1.PartitionWorkloadConditionProgressing:     metav1.ConditionUnknown,
+				workloadv1alpha1.PartitionWorkloadConditionRolloutComplete: metav1.ConditionFalse,
+			},
+			expectedReason: workloadv1alpha1.ReasonRolloutPaused,
+		},
+		{
+			name:     "Failed analysis stops progress",
+			pw:       getPW(3),
+			pods:     ready(flatten(sync.NewVersionedPods(getPW(3), currentRevision, 2), sync.NewVersionedPods(getPW(3), newRevision, 1))...),
+			analysis: &workloadv1alpha1.AnalysisStatus{Revision: newRevision, Phase: workloadv1alpha1.AnalysisPhaseFailed},
+			expectedStatuses: map[string]metav1.ConditionStatus{
+				workloadv1alpha1.PartitionWorkloadConditionProgressing: metav1.ConditionFalse,
+			},
+			expectedReason: workloadv1alpha1.ReasonAnalysisFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.pw.Generation = 5
+			updater := &realStatusUpdater{}
+			newStatus := &workloadv1alpha1.PartitionWorkloadStatus{
+				CurrentRevision: currentRevision,
+				UpdateRevision:  newRevision,
+				Analysis:        tt.analysis,
+			}
+			updater.calculateStatus(tt.pw, newStatus, tt.pods)
+			for condType, expected := range tt.expectedStatuses {
+				cond := condition.GetCondition(*newStatus, condType)
+				if cond == nil {
+					t.Fatalf("missing condition %s", condType)
+				}
+				if cond.Status != expected {
+					t.Errorf("%s = %s (%s), want %s", condType, cond.Status, cond.Message, expected)
+				}
+				if cond.ObservedGeneration != tt.pw.Generation {
+					t.Errorf("%s observedGeneration = %d, want %d", condType, cond.ObservedGeneration, tt.pw.Generation)
+				}
+			}
+			progressing := condition.GetCondition(*newStatus, workloadv1alpha1.PartitionWorkloadConditionProgressing)
+			if progressing.Reason != tt.expectedReason {
+				t.Errorf("Progressing reason = %s, want %s", progressing.Reason, tt.expectedReason)
+			}
+			if !updater.inconsistentStatus(tt.pw, newStatus) {
+				t.Errorf("new conditions should trigger a status update")
+			}
+		})
+	}
+}
+
+func ready(pods ...*v1.Pod) []*v1.Pod {
+	for _, pod := range pods {
+		pod.Status.Conditions = append(pod.Status.Conditions, v1.PodCondition{Type: v1.PodReady, Status: v1.ConditionTrue})
+	}
+	return pods
+}
+
+func withPartition(pw *workloadv1alpha1.PartitionWorkload, partition int32) *workloadv1alpha1.PartitionWorkload {
+	pw.Spec.Partition = generalutil.Int32Ptr(partition)
+	return pw
+}
+
+func paused(pw *workloadv1alpha1.PartitionWorkload) *workloadv1alpha1.PartitionWorkload {
+	pw.Spec.Paused = true
+	return pw
+}
+
 func getPW(replicas int32) *workloadv1alpha1.PartitionWorkload {
 	return &workloadv1alpha1.PartitionWorkload{
 		Spec: workloadv1alpha1.PartitionWorkloadSpec{
@@ -19,9 +19,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	analysis "github.com/2170chm/k8s-partition-workload/internal/controller/analysis"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/config"
+	gate "github.com/2170chm/k8s-partition-workload/internal/controller/gate"
+	migration "github.com/2170chm/k8s-partition-workload/internal/controller/migration"
 	revision "github.com/2170chm/k8s-partition-workload/internal/controller/revision"
 	status "github.com/2170chm/k8s-partition-workload/internal/controller/status"
 	sync "github.com/2170chm/k8s-partition-workload/internal/controller/sync"
+	traffic "github.com/2170chm/k8s-partition-workload/internal/controller/traffic"
 	"github.com/2170chm/k8s-partition-workload/internal/util/history"
 	// +kubebuilder:scaffold:imports
 )
@@ -76,12 +81,19 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 
 	Expect((&PartitionWorkloadReconciler{
-		Client:          k8sManager.GetClient(),
-		Scheme:          k8sManager.GetScheme(),
-		HistoryControl:  history.NewHistory(k8sManager.GetClient()),
-		SyncControl:     sync.NewSync(k8sManager.GetClient()),
-		StatusUpdater:   status.NewStatusUpdater(k8sManager.GetClient()),
-		RevisionControl: revision.NewRevisionControl(k8sManager.GetClient(), k8sManager.GetScheme()),
+		Client:           k8sManager.GetClient(),
+		Scheme:           k8sManager.GetScheme(),
+		HistoryControl:   history.NewHistory(k8sManager.GetClient()),
+		SyncControl:      sync.NewSync(k8sManager.GetClient()),
+		StatusUpdater:    status.NewStatusUpdater(k8sManager.GetClient()),
+		RevisionControl:  revision.NewRevisionControl(k8sManager.GetClient(), k8sManager.GetScheme()),
+		TrafficControl:   traffic.NewTrafficControl(k8sManager.GetClient()),
+		AnalysisControl:  analysis.NewAnalysisControl(),
+		GateControl:      gate.NewGateControl(),
+		MigrationControl: migration.NewMigrationControl(k8sManager.GetClient(), k8sManager.GetScheme()),
+		Recorder:         k8sManager.GetEventRecorder("partitionworkload-controller"),
+
+		DefaultHistoryLimit: config.DefaultHistoryLimit,
 	}).SetupWithManager(k8sManager)).To(Succeed())
 
 	go func() {
@@ -12,6 +12,8 @@ type Interface interface {
 		currentRevision, updateRevision string,
 		pods []*v1.Pod,
 	) error
+	SyncPodRoles(currentRevision, updateRevision string, pods []*v1.Pod) error
+	SyncIgnoredFields(pw *workloadv1alpha1.PartitionWorkload, pods []*v1.Pod) error
 }
 
 type realSync struct {
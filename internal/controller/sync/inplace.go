@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/revision"
+)
+
+// SyncIgnoredFields patches the labels, annotations and paths listed in spec.revisionHashIgnore of every pod to
+// their values in the pod template. They are not part of revisions, so changing them doesn't replace pods.
+// Paths are limited to pod fields that can be updated in place, within what the apiserver allows: an active
+// deadline is only set or lowered, and tolerations are only added.
+//
+// Parameters:
+// - pw: PartitionWorkload the pods belong to
+// - pods: All active pods owned by this PartitionWorkload
+//
+// Returns:
+// - error: any error encountered while patching
+func (r *realSync) SyncIgnoredFields(pw *workloadv1alpha1.PartitionWorkload, pods []*v1.Pod) error {
+	ignore := pw.Spec.RevisionHashIgnore
+	if ignore == nil || len(ignore.Labels)+len(ignore.Annotations)+len(ignore.Paths) == 0 {
+		return nil
+	}
+
+	var patched []*v1.Pod
+	for _, pod := range pods {
+		updated := pod.DeepCopy()
+		changed := syncKeys(&updated.Labels, pw.Spec.Template.Labels, ignore.Labels)
+		changed = syncKeys(&updated.Annotations, pw.Spec.Template.Annotations, ignore.Annotations) || changed
+		for _, path := range ignore.Paths {
+			tokens, err := revision.ParsePointer(path)
+			if err != nil || !revision.IsMutablePodPath(tokens) {
+				// Invalid paths are rejected by the webhook
+				continue
+			}
+			changed = syncPath(&updated.Spec, &pw.Spec.Template.Spec, tokens) || changed
+		}
+		if !changed {
+			continue
+		}
+		if err := r.Patch(context.TODO(), updated, client.MergeFrom(pod)); err != nil {
+			return err
+		}
+		patched = append(patched, updated)
+	}
+
+	if len(patched) > 0 {
+		klog.InfoS("---- ignored fields update ----")
+		klog.InfoS("Patched pod fields left out of revisions", "pods", klog.KObjSlice(patched))
+	}
+	return nil
+}
+
+// syncKeys sets the given keys of dst to their values in src, deleting those missing from src.
+// It returns true if dst changed.
+func syncKeys(dst *map[string]string, src map[string]string, keys []string) bool {
+	changed := false
+	for _, key := range keys {
+		current, exists := (*dst)[key]
+		value, ok := src[key]
+		switch {
+		case ok && (!exists || current != value):
+			if *dst == nil {
+				*dst = map[string]string{}
+			}
+			(*dst)[key] = value
+			changed = true
+		case !ok && exists:
+			delete(*dst, key)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// syncPath sets the pod field the reference tokens point at to its value in the template, as far as the
+// apiserver allows the update. The tokens must be a path accepted by revision.IsMutablePodPath.
+// It returns true if the pod spec changed.
+func syncPath(spec, template *v1.PodSpec, tokens []string) bool {
+	switch tokens[1] {
+	case "activeDeadlineSeconds":
+		want := template.ActiveDeadlineSeconds
+		if want == nil || (spec.ActiveDeadlineSeconds != nil && *spec.ActiveDeadlineSeconds <= *want) {
+			return false
+		}
+		spec.ActiveDeadlineSeconds = want
+		return true
+	case "tolerations":
+		changed := false
+		for _, toleration := range template.Tolerations {
+			if !hasToleration(spec.Tolerations, toleration) {
+				spec.Tolerations = append(spec.Tolerations, toleration)
+				changed = true
+			}
+		}
+		return changed
+	default:
+		containers, templateContainers := spec.Containers, template.Containers
+		if tokens[1] == "initContainers" {
+			containers, templateContainers = spec.InitContainers, template.InitContainers
+		}
+		index, _ := strconv.Atoi(tokens[2])
+		if index >= len(containers) || index >= len(templateContainers) ||
+			containers[index].Name != templateContainers[index].Name ||
+			containers[index].Image == templateContainers[index].Image {
+			return false
+		}
+		containers[index].Image = templateContainers[index].Image
+		return true
+	}
+}
+
+func hasToleration(tolerations []v1.Toleration, toleration v1.Toleration) bool {
+	for i := range tolerations {
+		if apiequality.Semantic.DeepEqual(tolerations[i], toleration) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+func TestSyncIgnoredFields(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW(2)
+	pw.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{
+		Labels:      []string{"build"},
+		Annotations: []string{"ci.example.com/build-id", "ci.example.com/removed"},
+		Paths:       []string{"/spec/containers/0/image", "/spec/activeDeadlineSeconds", "/spec/tolerations"},
+	}
+	pw.Spec.Template.Labels = map[string]string{"build": "2"}
+	pw.Spec.Template.Annotations = map[string]string{"ci.example.com/build-id": "2"}
+	pw.Spec.Template.Spec.Containers[0].Image = testUpdatedImage
+	pw.Spec.Template.Spec.ActiveDeadlineSeconds = ptr.To[int64](100)
+	toleration := v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpExists}
+	pw.Spec.Template.Spec.Tolerations = []v1.Toleration{toleration}
+
+	outdated := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   v1.NamespaceDefault,
+		Name:        testPodName + "-outdated",
+		Labels:      map[string]string{"build": "1", "other": "kept"},
+		Annotations: map[string]string{"ci.example.com/build-id": "1", "ci.example.com/removed": "x"},
+	}, Spec: v1.PodSpec{
+		Containers:            []v1.Container{{Name: testImage, Image: testImage}},
+		ActiveDeadlineSeconds: ptr.To[int64](200),
+	}}
+	synced := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   v1.NamespaceDefault,
+		Name:        testPodName + "-synced",
+		Labels:      map[string]string{"build": "2"},
+		Annotations: map[string]string{"ci.example.com/build-id": "2"},
+	}, Spec: v1.PodSpec{
+		Containers: []v1.Container{{Name: testImage, Image: testUpdatedImage}},
+		// A lower deadline is kept, as the apiserver doesn't allow raising it
+		ActiveDeadlineSeconds: ptr.To[int64](50),
+		Tolerations:           []v1.Toleration{toleration},
+	}}
+	pods := []*v1.Pod{outdated, synced}
+	for _, pod := range pods {
+		if err := r.Create(context.TODO(), pod); err != nil {
+			t.Fatalf("failed to create pod: %v", err)
+		}
+	}
+	syncedVersion := synced.ResourceVersion
+
+	if err := r.SyncIgnoredFields(pw, pods); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	stored := &v1.Pod{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(outdated), stored); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"build": "2", "other": "kept"}; !reflect.DeepEqual(stored.Labels, want) {
+		t.Errorf("want labels %v got %v", want, stored.Labels)
+	}
+	if want := map[string]string{"ci.example.com/build-id": "2"}; !reflect.DeepEqual(stored.Annotations, want) {
+		t.Errorf("want annotations %v got %v", want, stored.Annotations)
+	}
+	if image := stored.Spec.Containers[0].Image; image != testUpdatedImage {
+		t.Errorf("want image %s got %s", testUpdatedImage, image)
+	}
+	if deadline := ptr.Deref(stored.Spec.ActiveDeadlineSeconds, 0); deadline != 100 {
+		t.Errorf("want active deadline 100 got %d", deadline)
+	}
+	if want := []v1.Toleration{toleration}; !reflect.DeepEqual(stored.Spec.Tolerations, want) {
+		t.Errorf("want tolerations %v got %v", want, stored.Spec.Tolerations)
+	}
+
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(synced), stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.ResourceVersion != syncedVersion {
+		t.Errorf("pod already in sync was patched")
+	}
+}
@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+// instanceIDAllocator hands out instance IDs to new pods. IDs of pods that are about to be deleted are
+// handed out first, so that a pod replaced during a revision update keeps its identity.
+type instanceIDAllocator struct {
+	policy workloadv1alpha1.PodNamingPolicy
+	// inUse are the IDs of pods that are kept, still terminating, or already handed out
+	inUse sets.Set[string]
+	// reusable are the IDs of pods that are about to be deleted, in deletion order
+	reusable []string
+}
+
+// newInstanceIDAllocator returns an allocator for the pods of pw.
+//
+// Parameters:
+// - pw: PartitionWorkload whose spec.podNaming decides the kind of ID
+// - pods: All active pods owned by this PartitionWorkload
+// - podsToDelete: Pods that are deleted in this sync, whose IDs can be reused
+// - terminating: Pods of this PartitionWorkload that are being deleted. Their IDs are not handed out until they
+// are gone, as a new pod would get the name and the volume claims of the terminating one.
+func newInstanceIDAllocator(pw *workloadv1alpha1.PartitionWorkload, pods, podsToDelete, terminating []*v1.Pod) *instanceIDAllocator {
+	a := &instanceIDAllocator{
+		policy: PodNaming(pw),
+		inUse:  sets.New[string](),
+	}
+	deleted := sets.New[string]()
+	for _, pod := range podsToDelete {
+		deleted.Insert(pod.Name)
+		if id := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]; id != "" {
+			a.reusable = append(a.reusable, id)
+		}
+	}
+	for _, pod := range pods {
+		if deleted.Has(pod.Name) {
+			continue
+		}
+		if id := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]; id != "" {
+			a.inUse.Insert(id)
+		}
+	}
+	for _, pod := range terminating {
+		if id := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]; id != "" {
+			a.inUse.Insert(id)
+		}
+	}
+	return a
+}
+
+// listTerminatingPods returns the pods controlled by pw that are being deleted
+func (r *realSync) listTerminatingPods(pw *workloadv1alpha1.PartitionWorkload) ([]*v1.Pod, error) {
+	podList := &v1.PodList{}
+	if err := r.List(context.TODO(), podList, client.InNamespace(pw.Namespace)); err != nil {
+		return nil, err
+	}
+	var pods []*v1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp != nil && metav1.IsControlledBy(pod, pw) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// PodNaming returns the effective naming policy of pw. Volume claim templates need instance IDs, so it
+// defaults to Ordinal when pw has any.
+func PodNaming(pw *workloadv1alpha1.PartitionWorkload) workloadv1alpha1.PodNamingPolicy {
+	if pw.Spec.PodNaming != "" {
+		return pw.Spec.PodNaming
+	}
+	if len(pw.Spec.VolumeClaimTemplates) > 0 {
+		return workloadv1alpha1.PodNamingOrdinal
+	}
+	return workloadv1alpha1.PodNamingGenerated
+}
+
+// released returns the IDs of deleted pods that were not handed out to a replacement
+func (a *instanceIDAllocator) released() []string {
+	var ids []string
+	for _, id := range a.reusable {
+		if !a.inUse.Has(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// enabled reports whether pods get instance IDs at all
+func (a *instanceIDAllocator) enabled() bool {
+	return a.policy == workloadv1alpha1.PodNamingRandom || a.policy == workloadv1alpha1.PodNamingOrdinal
+}
+
+// next returns an ID no other kept pod uses, preferring the IDs of deleted pods
+func (a *instanceIDAllocator) next() string {
+	for len(a.reusable) > 0 {
+		id := a.reusable[0]
+		a.reusable = a.reusable[1:]
+		if !a.inUse.Has(id) {
+			a.inUse.Insert(id)
+			return id
+		}
+	}
+
+	var id string
+	switch a.policy {
+	case workloadv1alpha1.PodNamingOrdinal:
+		for i := 0; ; i++ {
+			if id = strconv.Itoa(i); !a.inUse.Has(id) {
+				break
+			}
+		}
+	default:
+		for id = rand.String(LengthOfInstanceID); a.inUse.Has(id); id = rand.String(LengthOfInstanceID) {
+		}
+	}
+	a.inUse.Insert(id)
+	return id
+}
+
+// setInstanceID labels pod with id and names it "<pw name>-<pod-template-hash>-<id>". The hash keeps the
+// name of a pod replaced by a revision update distinct from the terminating pod it replaces. Pods replaced at
+// the same revision, like those created with canary overrides, get the same name, so they are only recreated
+// once the pod they replace is gone.
+func setInstanceID(pod *v1.Pod, pwName, id string) {
+	pod.Labels[workloadv1alpha1.InstanceIDLabelKey] = id
+	pod.GenerateName = ""
+	pod.Name = fmt.Sprintf("%s-%s-%s", pwName, pod.Labels[apps.DefaultDeploymentUniqueLabelKey], id)
+}
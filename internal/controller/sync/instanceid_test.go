@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+func TestScaleAndUpdateInstanceIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		podNaming   workloadv1alpha1.PodNamingPolicy
+		replicas    int32
+		partition   int32
+		existingIDs []string
+		// terminatingIDs are the IDs of pods that are being deleted
+		terminatingIDs []string
+		expectedIDs    []string
+		expectedNames  []string
+	}{
+		{
+			name:          "Ordinal - replacement pod reuses the ID of the oldest pod",
+			podNaming:     workloadv1alpha1.PodNamingOrdinal,
+			replicas:      3,
+			partition:     1,
+			existingIDs:   []string{"0", "1", "2"},
+			expectedIDs:   []string{"0", "1", "2"},
+			expectedNames: []string{"test-pw-1-1", "test-pw-1-2", "test-pw-2-0"},
+		},
+		{
+			name:          "Ordinal - scale up fills the lowest free ordinals",
+			podNaming:     workloadv1alpha1.PodNamingOrdinal,
+			replicas:      4,
+			partition:     0,
+			existingIDs:   []string{"0", "2"},
+			expectedIDs:   []string{"0", "1", "2", "3"},
+			expectedNames: []string{"test-pw-1-0", "test-pw-1-1", "test-pw-1-2", "test-pw-1-3"},
+		},
+		{
+			name:           "Ordinal - IDs of terminating pods are not handed out",
+			podNaming:      workloadv1alpha1.PodNamingOrdinal,
+			replicas:       2,
+			partition:      0,
+			existingIDs:    []string{"0"},
+			terminatingIDs: []string{"1"},
+			expectedIDs:    []string{"0", "1", "2"},
+			expectedNames:  []string{"test-pw-1-0", "test-pw-1-1", "test-pw-1-2"},
+		},
+		{
+			name:          "Random - replacement pods reuse the IDs of the pods they replace",
+			podNaming:     workloadv1alpha1.PodNamingRandom,
+			replicas:      2,
+			partition:     2,
+			existingIDs:   []string{"abcde", "fghij"},
+			expectedIDs:   []string{"abcde", "fghij"},
+			expectedNames: []string{"test-pw-2-abcde", "test-pw-2-fghij"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeControl()
+			currentPW := getPW(tt.replicas)
+			currentPW.Spec.PodNaming = tt.podNaming
+			currentPW.Spec.Partition = generalutil.Int32Ptr(tt.partition)
+			updatedPW := currentPW.DeepCopy()
+			updatedPW.Spec.Template.Spec.Containers[0].Image = testUpdatedImage
+
+			var pods []*v1.Pod
+			for i, id := range tt.existingIDs {
+				pod := NewVersionedPods(currentPW, revision1, 1)[0]
+				setInstanceID(pod, testPWName, id)
+				pod.CreationTimestamp = metav1.NewTime(time.Unix(int64(i), 0))
+				if err := r.Create(context.TODO(), pod); err != nil {
+					t.Fatalf("failed to create pod: %v", err)
+				}
+				pods = append(pods, pod)
+			}
+			for _, id := range tt.terminatingIDs {
+				pod := NewVersionedPods(currentPW, revision1, 1)[0]
+				setInstanceID(pod, testPWName, id)
+				// The finalizer keeps the deleted pod around as terminating
+				pod.Finalizers = []string{"test/finalizer"}
+				if err := r.Create(context.TODO(), pod); err != nil {
+					t.Fatalf("failed to create pod: %v", err)
+				}
+				if err := r.Delete(context.TODO(), pod); err != nil {
+					t.Fatalf("failed to delete pod: %v", err)
+				}
+			}
+
+			if err := r.ScaleAndUpdate(currentPW, updatedPW, revision1, revision2, pods); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			podList := v1.PodList{}
+			if err := r.List(context.TODO(), &podList, client.InNamespace(v1.NamespaceDefault)); err != nil {
+				t.Fatalf("failed to list pods: %v", err)
+			}
+			var ids, names []string
+			for _, pod := range podList.Items {
+				ids = append(ids, pod.Labels[workloadv1alpha1.InstanceIDLabelKey])
+				names = append(names, pod.Name)
+				if expected := fmt.Sprintf("%s-%s-%s", testPWName, pod.Labels[apps.DefaultDeploymentUniqueLabelKey],
+					pod.Labels[workloadv1alpha1.InstanceIDLabelKey]); pod.Name != expected {
+					t.Errorf("pod name = %s, want %s", pod.Name, expected)
+				}
+			}
+			sort.Strings(ids)
+			sort.Strings(names)
+			if fmt.Sprint(ids) != fmt.Sprint(tt.expectedIDs) {
+				t.Errorf("instance IDs = %v, want %v", ids, tt.expectedIDs)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.expectedNames) {
+				t.Errorf("pod names = %v, want %v", names, tt.expectedNames)
+			}
+		})
+	}
+}
+
+func TestInstanceIDAllocatorRandom(t *testing.T) {
+	pw := getPW(3)
+	pw.Spec.PodNaming = workloadv1alpha1.PodNamingRandom
+	a := newInstanceIDAllocator(pw, nil, nil, nil)
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := a.next()
+		if len(id) != LengthOfInstanceID {
+			t.Fatalf("instance ID %q has length %d, want %d", id, len(id), LengthOfInstanceID)
+		}
+		if seen[id] {
+			t.Fatalf("instance ID %q handed out twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestInstanceIDAllocatorGenerated(t *testing.T) {
+	r := newFakeControl()
+	pw := getPW(2)
+	if err := r.ScaleAndUpdate(pw, pw.DeepCopy(), revision1, revision1, nil); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	podList := v1.PodList{}
+	if err := r.List(context.TODO(), &podList, client.InNamespace(v1.NamespaceDefault)); err != nil {
+		t.Fatalf("failed to list pods: %v", err)
+	}
+	for _, pod := range podList.Items {
+		if pod.GenerateName != testPWName+"-" {
+			t.Errorf("pod %s has generateName %q, want %q", pod.Name, pod.GenerateName, testPWName+"-")
+		}
+		if _, ok := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]; ok {
+			t.Errorf("pod %s has an instance ID with the Generated naming policy", pod.Name)
+		}
+	}
+}
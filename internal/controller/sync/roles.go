@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+// SyncPodRoles patches the role label of every pod whose role changed, e.g. because the update revision
+// became the current revision.
+//
+// Parameters:
+// - currentRevision: Name of the stable revision
+// - updateRevision: Name of the target revision
+// - pods: All active pods owned by this PartitionWorkload
+//
+// Returns:
+// - error: any error encountered while patching
+func (r *realSync) SyncPodRoles(currentRevision, updateRevision string, pods []*v1.Pod) error {
+	var patched []*v1.Pod
+	for _, pod := range pods {
+		role := string(podRole(pod, currentRevision, updateRevision))
+		if pod.Labels[workloadv1alpha1.RoleLabelKey] == role {
+			continue
+		}
+		updated := pod.DeepCopy()
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		updated.Labels[workloadv1alpha1.RoleLabelKey] = role
+		if err := r.Patch(context.TODO(), updated, client.MergeFrom(pod)); err != nil {
+			return err
+		}
+		patched = append(patched, updated)
+	}
+
+	if len(patched) > 0 {
+		klog.InfoS("---- pod roles update ----")
+		klog.InfoS("Patched pod roles", "pods", klog.KObjSlice(patched))
+	}
+	return nil
+}
+
+// podRole returns the role of pod given the revisions of its PartitionWorkload
+func podRole(pod *v1.Pod, currentRevision, updateRevision string) workloadv1alpha1.PodRole {
+	switch {
+	case generalutil.EqualToRevisionHash(pod, currentRevision):
+		return workloadv1alpha1.PodRoleStable
+	case generalutil.EqualToRevisionHash(pod, updateRevision):
+		return workloadv1alpha1.PodRoleCanary
+	default:
+		return workloadv1alpha1.PodRoleStale
+	}
+}
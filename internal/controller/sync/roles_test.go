@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+func TestSyncPodRoles(t *testing.T) {
+	const revision3 = "3"
+
+	tests := []struct {
+		name            string
+		currentRevision string
+		updateRevision  string
+		existingRoles   map[string]string
+		expectedRoles   map[string]workloadv1alpha1.PodRole
+	}{
+		{
+			name:            "Partial rollout - stable, canary and stale pods",
+			currentRevision: revision1,
+			updateRevision:  revision2,
+			expectedRoles: map[string]workloadv1alpha1.PodRole{
+				revision1: workloadv1alpha1.PodRoleStable,
+				revision2: workloadv1alpha1.PodRoleCanary,
+				revision3: workloadv1alpha1.PodRoleStale,
+			},
+		},
+		{
+			name:            "Completed rollout - canary pods become stable",
+			currentRevision: revision2,
+			updateRevision:  revision2,
+			existingRoles: map[string]string{
+				revision1: string(workloadv1alpha1.PodRoleStable),
+				revision2: string(workloadv1alpha1.PodRoleCanary),
+			},
+			expectedRoles: map[string]workloadv1alpha1.PodRole{
+				revision1: workloadv1alpha1.PodRoleStale,
+				revision2: workloadv1alpha1.PodRoleStable,
+				revision3: workloadv1alpha1.PodRoleStale,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeControl()
+			var pods []*v1.Pod
+			for _, revision := range []string{revision1, revision2, revision3} {
+				pod := &v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: v1.NamespaceDefault,
+						Name:      testPodName + "-" + revision,
+						Labels:    map[string]string{apps.ControllerRevisionHashLabelKey: revision},
+					},
+				}
+				if role, ok := tt.existingRoles[revision]; ok {
+					pod.Labels[workloadv1alpha1.RoleLabelKey] = role
+				}
+				if err := r.Create(context.TODO(), pod); err != nil {
+					t.Fatalf("failed to create pod: %v", err)
+				}
+				pods = append(pods, pod)
+			}
+
+			if err := r.SyncPodRoles(tt.currentRevision, tt.updateRevision, pods); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			podList := v1.PodList{}
+			if err := r.List(context.TODO(), &podList, client.InNamespace(v1.NamespaceDefault)); err != nil {
+				t.Fatalf("failed to list pods: %v", err)
+			}
+			for _, pod := range podList.Items {
+				revision := pod.Labels[apps.ControllerRevisionHashLabelKey]
+				if got := pod.Labels[workloadv1alpha1.RoleLabelKey]; got != string(tt.expectedRoles[revision]) {
+					t.Errorf("pod at revision %s has role %q, want %q", revision, got, tt.expectedRoles[revision])
+				}
+			}
+		})
+	}
+}
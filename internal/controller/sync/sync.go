@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
 	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
@@ -67,17 +69,60 @@ func (r *realSync) ScaleAndUpdate(
 	klog.InfoS("Pods with updated revision", "detail", klog.KObjSlice(updatedPods))
 	klog.InfoS("Pods with other revisions", "detail", klog.KObjSlice(notUpdatedPods))
 
+	// Pods to delete are selected before creating pods so that their replacements can reuse their instance IDs
+	podsToDelete, err := selectPodsToDelete(diffRes.scaleDownNum, diffRes.scaleDownNumOldRevision, updatedPods, notUpdatedPods)
+	if err != nil {
+		return err
+	}
+	namedByID := PodNaming(updatedPW) != workloadv1alpha1.PodNamingGenerated
+	var terminating []*v1.Pod
+	if namedByID || currentRevision == updatedRevision {
+		if terminating, err = r.listTerminatingPods(updatedPW); err != nil {
+			return err
+		}
+	}
+
+	// Once the rollout is complete, pods created with the canary overrides are recreated without them, one at a
+	// time. A pod named by instance ID is only recreated once it is gone, as the replacement could get its name and
+	// claims. Ordinal naming hands it the freed ordinal again, while Random naming picks a new ID.
+	var canaryPod *v1.Pod
+	if currentRevision == updatedRevision && diffRes.isEmpty() {
+		if canaryPod = selectCanaryPod(updatedPW, pods, terminating); canaryPod != nil && !namedByID {
+			diffRes.scaleUpNum++
+		}
+	}
+	if namedByID && hasCanaryPod(terminating) {
+		diffRes.scaleUpNum = 0
+	}
+	instanceIDs := newInstanceIDAllocator(updatedPW, pods, podsToDelete, terminating)
+
+	if len(updatedPW.Spec.VolumeClaimTemplates) > 0 {
+		if err := r.syncClaimOwnership(updatedPW, pods); err != nil {
+			return err
+		}
+	}
+
 	// PHASE 3: Scale up - create new pods if we need more replicas
 	// Create the pods (some with old template, some with new)
 	if err := r.createPods(diffRes.scaleUpNum, diffRes.scaleUpNumOldRevision,
-		currentPW, updatedPW, currentRevision, updatedRevision); err != nil {
+		currentPW, updatedPW, currentRevision, updatedRevision, instanceIDs); err != nil {
 		return err
 	}
 
 	// PHASE 4: Scale down - delete excess pods when replicas is reduced
-	if err := r.deletePods(diffRes.scaleDownNum, diffRes.scaleDownNumOldRevision, updatedPods, notUpdatedPods); err != nil {
+	if err := r.deletePods(podsToDelete); err != nil {
 		return err
 	}
+	if canaryPod != nil {
+		if err := r.deletePods([]*v1.Pod{canaryPod}); err != nil {
+			return err
+		}
+	}
+	if len(updatedPW.Spec.VolumeClaimTemplates) > 0 {
+		if err := r.deleteReleasedClaims(updatedPW, instanceIDs.released()); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -92,6 +137,7 @@ func (r *realSync) ScaleAndUpdate(
 // - currentPW: PartitionWorkload with old pod template
 // - updatedPW: PartitionWorkload with new pod template
 // - currentRevision, updatedRevision: revision names for labeling pods
+// - instanceIDs: allocator of the instance IDs of the new pods
 //
 // Returns:
 // - error: any error encountered (may be partial success)
@@ -99,6 +145,7 @@ func (r *realSync) createPods(
 	expectedUpdatedCreations, expectedCurrentCreations int,
 	currentPW, updatedPW *workloadv1alpha1.PartitionWorkload,
 	currentRevision, updatedRevision string,
+	instanceIDs *instanceIDAllocator,
 ) error {
 	if expectedCurrentCreations == 0 && expectedUpdatedCreations == 0 {
 		return nil
@@ -109,6 +156,15 @@ func (r *realSync) createPods(
 	if err != nil {
 		return err
 	}
+	for _, pod := range newPods {
+		pod.Labels[workloadv1alpha1.RoleLabelKey] = string(podRole(pod, currentRevision, updatedRevision))
+	}
+	if instanceIDs.enabled() {
+		for _, pod := range newPods {
+			setInstanceID(pod, updatedPW.Name, instanceIDs.next())
+			updatePodVolumes(updatedPW, pod)
+		}
+	}
 
 	klog.InfoS("---- pod creation plan ----")
 	klog.InfoS("expectedCurrentCreations", "count", expectedCurrentCreations)
@@ -124,6 +180,12 @@ func (r *realSync) createPods(
 	// DoItSlowly uses exponential backoff for batch sizes
 	_, err = generalutil.DoItSlowly(len(newPods), initialBatchSize, func() error {
 		pod := <-podsCreationChan
+		// Claims are created first so that the pod does not wait on a missing claim
+		if len(updatedPW.Spec.VolumeClaimTemplates) > 0 {
+			if err := r.createMissingClaims(updatedPW, pod); err != nil {
+				return err
+			}
+		}
 		if createErr := r.Create(context.TODO(), pod); createErr != nil {
 			return createErr
 		}
@@ -133,19 +195,25 @@ func (r *realSync) createPods(
 	return err
 }
 
-// deletePods deletes a batch of pods
-
+// selectPodsToDelete picks the pods to delete for scale-in, oldest first within each revision group
+//
+// Parameters:
+// - expectedUpdatedDeletions: number of pods with the updated revision to delete
+// - expectedCurrentDeletions: number of pods with other revisions to delete
+// - updatedPods, notUpdatedPods: active pods grouped by whether they're on the updated revision
+//
 // Returns:
-// - error: any error encountered
-func (r *realSync) deletePods(expectedUpdatedDeletions int, expectedCurrentDeletions int, updatedPods, notUpdatedPods []*v1.Pod) error {
+// - the pods to delete
+// - error: if a group does not have enough pods
+func selectPodsToDelete(expectedUpdatedDeletions int, expectedCurrentDeletions int, updatedPods, notUpdatedPods []*v1.Pod) ([]*v1.Pod, error) {
 	if expectedUpdatedDeletions == 0 && expectedCurrentDeletions == 0 {
-		return nil
+		return nil, nil
 	}
 
 	var podsToDelete []*v1.Pod
 	if expectedUpdatedDeletions > 0 {
 		if len(updatedPods) < expectedUpdatedDeletions {
-			return fmt.Errorf(notEnoughPodsWithUpdatedRevisionToDeleteErrString)
+			return nil, fmt.Errorf(notEnoughPodsWithUpdatedRevisionToDeleteErrString)
 		}
 		sortPodsOldestFirst(updatedPods)
 		podsToDelete = append(podsToDelete, updatedPods[:expectedUpdatedDeletions]...)
@@ -153,7 +221,7 @@ func (r *realSync) deletePods(expectedUpdatedDeletions int, expectedCurrentDelet
 
 	if expectedCurrentDeletions > 0 {
 		if len(notUpdatedPods) < expectedCurrentDeletions {
-			return fmt.Errorf(notEnoughPodsWithCurrentRevisionToDeleteErrString)
+			return nil, fmt.Errorf(notEnoughPodsWithCurrentRevisionToDeleteErrString)
 		}
 		sortPodsOldestFirst(notUpdatedPods)
 		podsToDelete = append(podsToDelete, notUpdatedPods[:expectedCurrentDeletions]...)
@@ -164,6 +232,48 @@ func (r *realSync) deletePods(expectedUpdatedDeletions int, expectedCurrentDelet
 	klog.InfoS("expectedUpdatedDeletions", "count", expectedUpdatedDeletions)
 	klog.InfoS("pods object to delete", "pod", klog.KObjSlice(podsToDelete))
 
+	return podsToDelete, nil
+}
+
+// selectCanaryPod returns the oldest of the pods created with the canary overrides, or nil if there is none or
+// the previous replacement is not done yet, i.e. some pod is not available or still terminating
+func selectCanaryPod(pw *workloadv1alpha1.PartitionWorkload, pods, terminating []*v1.Pod) *v1.Pod {
+	if len(terminating) > 0 {
+		return nil
+	}
+	var canaryPods []*v1.Pod
+	now := metav1.Now()
+	for _, pod := range pods {
+		if !podutil.IsPodAvailable(pod, pw.Spec.MinReadySeconds, now) {
+			return nil
+		}
+		if _, ok := pod.Annotations[workloadv1alpha1.CanaryOverridesAnnotationKey]; ok {
+			canaryPods = append(canaryPods, pod)
+		}
+	}
+	if len(canaryPods) == 0 {
+		return nil
+	}
+	sortPodsOldestFirst(canaryPods)
+	klog.InfoS("---- canary pod replacement ----")
+	klog.InfoS("Replacing pod created with canary overrides", "pod", klog.KObj(canaryPods[0]), "remaining", len(canaryPods)-1)
+	return canaryPods[0]
+}
+
+func hasCanaryPod(pods []*v1.Pod) bool {
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[workloadv1alpha1.CanaryOverridesAnnotationKey]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// deletePods deletes a batch of pods
+//
+// Returns:
+// - error: any error encountered
+func (r *realSync) deletePods(podsToDelete []*v1.Pod) error {
 	for _, pod := range podsToDelete {
 		if err := r.Delete(context.TODO(), pod); err != nil {
 			return err
@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
@@ -56,6 +57,7 @@ func TestCreatePods(t *testing.T) {
 		updatePW,
 		revision1,
 		revision2,
+		newInstanceIDAllocator(updatePW, nil, nil, nil),
 	)
 	if err != nil {
 		t.Fatalf("got unexpected error: %v", err)
@@ -79,6 +81,7 @@ func TestCreatePods(t *testing.T) {
 				Labels: map[string]string{
 					apps.ControllerRevisionHashLabelKey:  revision1,
 					apps.DefaultDeploymentUniqueLabelKey: revision1,
+					workloadv1alpha1.RoleLabelKey:        string(workloadv1alpha1.PodRoleStable),
 				},
 				OwnerReferences: []metav1.OwnerReference{
 					{
@@ -109,6 +112,7 @@ func TestCreatePods(t *testing.T) {
 				Labels: map[string]string{
 					apps.ControllerRevisionHashLabelKey:  revision2,
 					apps.DefaultDeploymentUniqueLabelKey: revision2,
+					workloadv1alpha1.RoleLabelKey:        string(workloadv1alpha1.PodRoleCanary),
 				},
 				OwnerReferences: []metav1.OwnerReference{
 					{
@@ -195,7 +199,11 @@ func TestDeletePods(t *testing.T) {
 	if len(updatedPods) != 1 || len(notUpdatedPods) != 1 {
 		t.Fatalf("Incorrect grouping of updated and not updated pods - updated pods: %v, not updated pods: %v", updatedPods, notUpdatedPods)
 	}
-	err := r.deletePods(1, 1, updatedPods, notUpdatedPods)
+	selected, err := selectPodsToDelete(1, 1, updatedPods, notUpdatedPods)
+	if err != nil {
+		t.Fatalf("failed to select pods to delete: %v", err)
+	}
+	err = r.deletePods(selected)
 	if err != nil {
 		t.Fatalf("failed to delete pods: %v", err)
 	}
@@ -208,12 +216,12 @@ func TestDeletePods(t *testing.T) {
 		t.Fatalf("expected no pods left, actually: %v", gotPods.Items)
 	}
 
-	err = r.deletePods(2, 1, updatedPods, notUpdatedPods)
+	_, err = selectPodsToDelete(2, 1, updatedPods, notUpdatedPods)
 	if err == nil || !strings.Contains(err.Error(), notEnoughPodsWithUpdatedRevisionToDeleteErrString) {
 		t.Fatalf("failed to detect that not enough pods with updated revision can be deleted: %v", err)
 	}
 
-	err = r.deletePods(1, 2, updatedPods, notUpdatedPods)
+	_, err = selectPodsToDelete(1, 2, updatedPods, notUpdatedPods)
 	if err == nil || !strings.Contains(err.Error(), notEnoughPodsWithCurrentRevisionToDeleteErrString) {
 		t.Fatalf("failed to detect that not enough pods with updated revision can be deleted: %v", err)
 	}
@@ -730,6 +738,273 @@ func TestScaleAndUpdate(t *testing.T) {
 	}
 }
 
+func TestScaleAndUpdateReplacesCanaryPods(t *testing.T) {
+	tests := []struct {
+		name      string
+		podNaming workloadv1alpha1.PodNamingPolicy
+		ids       []string
+	}{
+		{name: "Generated", podNaming: workloadv1alpha1.PodNamingGenerated},
+		{name: "Ordinal", podNaming: workloadv1alpha1.PodNamingOrdinal, ids: []string{"0", "1", "2"}},
+		{name: "Random", podNaming: workloadv1alpha1.PodNamingRandom, ids: []string{"abcde", "fghij", "klmno"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeControl()
+			pw := getPW(3)
+			pw.Spec.PodNaming = tt.podNaming
+			pw.Spec.Template.Spec.Containers[0].Image = testUpdatedImage
+			namedByID := tt.podNaming != workloadv1alpha1.PodNamingGenerated
+
+			// Two of the three pods were created with the canary overrides while the rollout was partial.
+			// The finalizer keeps deleted pods around as terminating until the test lets them go.
+			for i := 0; i < 3; i++ {
+				pod := NewVersionedPods(pw, revision2, 1)[0]
+				if namedByID {
+					setInstanceID(pod, testPWName, tt.ids[i])
+				} else {
+					pod.Name = fmt.Sprintf("%s-%d", testPodName, i)
+				}
+				if i < 2 {
+					pod.Annotations = map[string]string{workloadv1alpha1.CanaryOverridesAnnotationKey: "true"}
+				}
+				pod.CreationTimestamp = metav1.NewTime(time.Unix(int64(i), 0))
+				pod.Finalizers = []string{"test/finalizer"}
+				if err := r.Create(context.TODO(), pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+			markCanaryTestPodsReady(t, r)
+
+			sync := func() (active, terminating []v1.Pod) {
+				t.Helper()
+				podList := &v1.PodList{}
+				if err := r.List(context.TODO(), podList); err != nil {
+					t.Fatal(err)
+				}
+				var pods []*v1.Pod
+				for i := range podList.Items {
+					if podList.Items[i].DeletionTimestamp == nil {
+						pods = append(pods, &podList.Items[i])
+					}
+				}
+				if err := r.ScaleAndUpdate(pw, pw, revision2, revision2, pods); err != nil {
+					t.Fatal(err)
+				}
+				if err := r.List(context.TODO(), podList); err != nil {
+					t.Fatal(err)
+				}
+				for _, pod := range podList.Items {
+					if pod.DeletionTimestamp == nil {
+						active = append(active, pod)
+					} else {
+						terminating = append(terminating, pod)
+					}
+				}
+				return active, terminating
+			}
+
+			// The oldest canary pod is replaced first. Pods named by ID are only deleted, as the replacement
+			// gets the same name.
+			active, terminating := sync()
+			wantActive := 3
+			if namedByID {
+				wantActive = 2
+			}
+			if len(active) != wantActive || len(terminating) != 1 || terminating[0].CreationTimestamp.Unix() != 0 {
+				t.Fatalf("want %d active pods and the oldest canary pod terminating, got %d active and %d terminating",
+					wantActive, len(active), len(terminating))
+			}
+
+			// Nothing moves while the canary pod is terminating
+			if active, terminating = sync(); len(active) != wantActive || len(terminating) != 1 {
+				t.Fatalf("want no change while the canary pod is terminating, got %d active and %d terminating",
+					len(active), len(terminating))
+			}
+
+			// Once it is gone, pods named by ID are recreated. The next canary pod waits for the replacement
+			// to become ready.
+			removeCanaryTestFinalizers(t, r, terminating)
+			if active, terminating = sync(); len(active) != 3 || len(terminating) != 0 {
+				t.Fatalf("want 3 active pods waiting for the replacement to be ready, got %d active and %d terminating",
+					len(active), len(terminating))
+			}
+			if tt.podNaming == workloadv1alpha1.PodNamingOrdinal && !hasCanaryTestPodID(active, "0") {
+				t.Errorf("want the replacement to reuse instance ID 0, got pods %v", canaryTestPodNames(active))
+			}
+
+			for i := 0; i < 4; i++ {
+				markCanaryTestPodsReady(t, r)
+				_, terminating = sync()
+				removeCanaryTestFinalizers(t, r, terminating)
+			}
+			active, _ = sync()
+			for _, pod := range active {
+				if _, ok := pod.Annotations[workloadv1alpha1.CanaryOverridesAnnotationKey]; ok {
+					t.Errorf("pod %s still carries the canary overrides", pod.Name)
+				}
+			}
+			if len(active) != 3 {
+				t.Errorf("want 3 pods got %v", canaryTestPodNames(active))
+			}
+			ids := canaryTestPodIDs(active)
+			switch tt.podNaming {
+			case workloadv1alpha1.PodNamingOrdinal:
+				if fmt.Sprint(ids) != fmt.Sprint(tt.ids) {
+					t.Errorf("instance IDs = %v, want %v", ids, tt.ids)
+				}
+			case workloadv1alpha1.PodNamingRandom:
+				if !hasCanaryTestPodID(active, "klmno") || ids[0] == ids[1] || ids[1] == ids[2] {
+					t.Errorf("want distinct instance IDs keeping klmno, got %v", ids)
+				}
+			}
+		})
+	}
+
+	t.Run("Canary pods are kept while the rollout is partial", func(t *testing.T) {
+		r := newFakeControl()
+		pw := getPW(1)
+		pod := NewVersionedPods(pw, revision2, 1)[0]
+		pod.Name = testPodName
+		pod.Annotations = map[string]string{workloadv1alpha1.CanaryOverridesAnnotationKey: "true"}
+		if err := r.Create(context.TODO(), pod); err != nil {
+			t.Fatal(err)
+		}
+		markCanaryTestPodsReady(t, r)
+		pw.Spec.Partition = generalutil.Int32Ptr(1)
+		if err := r.ScaleAndUpdate(pw, pw, revision1, revision2, []*v1.Pod{pod}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Get(context.TODO(), client.ObjectKeyFromObject(pod), &v1.Pod{}); err != nil {
+			t.Errorf("want the canary pod kept got %v", err)
+		}
+	})
+}
+
+func markCanaryTestPodsReady(t *testing.T, r *realSync) {
+	t.Helper()
+	podList := &v1.PodList{}
+	if err := r.List(context.TODO(), podList); err != nil {
+		t.Fatal(err)
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+		if err := r.Status().Update(context.TODO(), pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func removeCanaryTestFinalizers(t *testing.T, r *realSync, pods []v1.Pod) {
+	t.Helper()
+	for i := range pods {
+		pods[i].Finalizers = nil
+		if err := r.Update(context.TODO(), &pods[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func hasCanaryTestPodID(pods []v1.Pod, id string) bool {
+	for _, pod := range pods {
+		if pod.Labels[workloadv1alpha1.InstanceIDLabelKey] == id {
+			return true
+		}
+	}
+	return false
+}
+
+func canaryTestPodIDs(pods []v1.Pod) []string {
+	var ids []string
+	for _, pod := range pods {
+		ids = append(ids, pod.Labels[workloadv1alpha1.InstanceIDLabelKey])
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func canaryTestPodNames(pods []v1.Pod) []string {
+	var names []string
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestCalculateDiffsWithReplicasAndPartitionChanges(t *testing.T) {
+	tests := []struct {
+		name            string
+		replicas        int32
+		partition       *int32
+		currentPods     int
+		updatedPods     int
+		expectedDiffRes expectationDiffs
+	}{
+		{
+			name:            "Scale in while advancing the partition - replicas 5 -> 3, partition 2 -> 3",
+			replicas:        3,
+			partition:       generalutil.Int32Ptr(3),
+			currentPods:     3,
+			updatedPods:     2,
+			expectedDiffRes: expectationDiffs{scaleUpNum: 1, scaleDownNumOldRevision: 3},
+		},
+		{
+			name:            "Scale out while advancing the partition - replicas 3 -> 6, partition 1 -> 4",
+			replicas:        6,
+			partition:       generalutil.Int32Ptr(4),
+			currentPods:     2,
+			updatedPods:     1,
+			expectedDiffRes: expectationDiffs{scaleUpNum: 3},
+		},
+		{
+			name:            "Scale in below an unchanged partition - replicas 5 -> 2, partition 4 is clamped",
+			replicas:        2,
+			partition:       generalutil.Int32Ptr(4),
+			currentPods:     1,
+			updatedPods:     4,
+			expectedDiffRes: expectationDiffs{scaleDownNum: 2, scaleDownNumOldRevision: 1},
+		},
+		{
+			name:            "Scale in while rolling back the partition - replicas 4 -> 2, partition 3 -> 1",
+			replicas:        2,
+			partition:       generalutil.Int32Ptr(1),
+			currentPods:     1,
+			updatedPods:     3,
+			expectedDiffRes: expectationDiffs{scaleDownNum: 2},
+		},
+		{
+			name:            "Scale out with partition unset - replicas 2 -> 4",
+			replicas:        4,
+			currentPods:     1,
+			updatedPods:     1,
+			expectedDiffRes: expectationDiffs{scaleUpNum: 3, scaleDownNumOldRevision: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw := getPW(tt.replicas)
+			pw.Spec.Partition = tt.partition
+			pods := append(
+				generatePods(&v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: revision1, Labels: map[string]string{apps.ControllerRevisionHashLabelKey: revision1}},
+					Spec:       v1.PodSpec{Containers: []v1.Container{{Name: testImage}}},
+				}, tt.currentPods),
+				generatePods(&v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: revision2, Labels: map[string]string{apps.ControllerRevisionHashLabelKey: revision2}},
+					Spec:       v1.PodSpec{Containers: []v1.Container{{Name: testUpdatedImage}}},
+				}, tt.updatedPods)...,
+			)
+
+			diffRes := calculateDiffs(pw, pods, revision1, revision2)
+			if diffRes != tt.expectedDiffRes {
+				t.Errorf("calculateDiffs() = %v, want %v", diffRes, tt.expectedDiffRes)
+			}
+		})
+	}
+}
+
 func newFakeControl() *realSync {
 	return &realSync{
 		Client: fake.NewClientBuilder().Build(),
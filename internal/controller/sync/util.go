@@ -3,7 +3,6 @@ package sync
 import (
 	"fmt"
 	"reflect"
-	"strings"
 
 	"k8s.io/utils/integer"
 
@@ -143,7 +142,7 @@ func NewVersionedPods(pw *workloadv1alpha1.PartitionWorkload, revision string, r
 		}
 
 		// Write revision hash to labels for revision management
-		writeRevisionHash(pod, revision)
+		WriteRevisionHash(pod, revision)
 
 		// Let k8s generate random name
 		pod.GenerateName = fmt.Sprintf("%s-", pw.Name)
@@ -155,20 +154,15 @@ func NewVersionedPods(pw *workloadv1alpha1.PartitionWorkload, revision string, r
 	return newPods
 }
 
-func writeRevisionHash(obj metav1.Object, hash string) {
+// WriteRevisionHash labels obj with the revision hash and the matching pod-template-hash
+func WriteRevisionHash(obj metav1.Object, hash string) {
 	if obj.GetLabels() == nil {
 		obj.SetLabels(make(map[string]string, 1))
 	}
 	// Controller-revision-hash defaults to be "{PartitionWorkload_NAME}-{HASH}",
 	// pod-template-hash should always be the short format.
 	obj.GetLabels()[apps.ControllerRevisionHashLabelKey] = hash
-	obj.GetLabels()[apps.DefaultDeploymentUniqueLabelKey] = getShortHash(hash)
-}
-
-func getShortHash(hash string) string {
-	// This makes sure the real hash must be the last '-' substring of revision name
-	list := strings.Split(hash, "-")
-	return list[len(list)-1]
+	obj.GetLabels()[apps.DefaultDeploymentUniqueLabelKey] = generalutil.GetShortHash(hash)
 }
 
 func sortPodsOldestFirst(pods []*v1.Pod) {
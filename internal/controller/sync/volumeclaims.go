@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+// ClaimName returns the name of the claim created from tmpl for the pod with the given instance ID
+func ClaimName(tmpl *v1.PersistentVolumeClaim, pwName, id string) string {
+	return fmt.Sprintf("%s-%s-%s", tmpl.Name, pwName, id)
+}
+
+// updatePodVolumes mounts the claims of the pod's instance ID. A volume of the pod template with the same
+// name as a claim template is replaced, the way StatefulSets do it.
+func updatePodVolumes(pw *workloadv1alpha1.PartitionWorkload, pod *v1.Pod) {
+	id := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]
+	for i := range pw.Spec.VolumeClaimTemplates {
+		tmpl := &pw.Spec.VolumeClaimTemplates[i]
+		volume := v1.Volume{
+			Name: tmpl.Name,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+					ClaimName: ClaimName(tmpl, pw.Name, id),
+				},
+			},
+		}
+		replaced := false
+		for j := range pod.Spec.Volumes {
+			if pod.Spec.Volumes[j].Name == volume.Name {
+				pod.Spec.Volumes[j] = volume
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+		}
+	}
+}
+
+// newClaim builds the claim created from tmpl for the given instance ID. It carries the selector labels of
+// pw and the instance ID label, and is owned by pw if claims are deleted together with it.
+func newClaim(pw *workloadv1alpha1.PartitionWorkload, tmpl *v1.PersistentVolumeClaim, id string) *v1.PersistentVolumeClaim {
+	claim := tmpl.DeepCopy()
+	claim.ObjectMeta = metav1.ObjectMeta{
+		Name:        ClaimName(tmpl, pw.Name, id),
+		Namespace:   pw.Namespace,
+		Labels:      map[string]string{},
+		Annotations: claim.Annotations,
+	}
+	for k, v := range tmpl.Labels {
+		claim.Labels[k] = v
+	}
+	if pw.Spec.Selector != nil {
+		for k, v := range pw.Spec.Selector.MatchLabels {
+			claim.Labels[k] = v
+		}
+	}
+	claim.Labels[workloadv1alpha1.InstanceIDLabelKey] = id
+	claim.Status = v1.PersistentVolumeClaimStatus{}
+	if deleteClaimsWith(pw) {
+		claim.OwnerReferences = []metav1.OwnerReference{claimOwnerRef(pw)}
+	}
+	return claim
+}
+
+// createMissingClaims creates the claims of the pod's instance ID that do not exist yet
+func (r *realSync) createMissingClaims(pw *workloadv1alpha1.PartitionWorkload, pod *v1.Pod) error {
+	id := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]
+	for i := range pw.Spec.VolumeClaimTemplates {
+		claim := newClaim(pw, &pw.Spec.VolumeClaimTemplates[i], id)
+		err := r.Get(context.TODO(), client.ObjectKeyFromObject(claim), &v1.PersistentVolumeClaim{})
+		if err == nil {
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err := r.Create(context.TODO(), claim); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		klog.InfoS("Created PersistentVolumeClaim", "PartitionWorkload", klog.KObj(pw), "claim", klog.KObj(claim))
+	}
+	return nil
+}
+
+// syncClaimOwnership adds or removes pw from the owners of the claims of the given pods, following
+// spec.persistentVolumeClaimRetentionPolicy.whenDeleted
+func (r *realSync) syncClaimOwnership(pw *workloadv1alpha1.PartitionWorkload, pods []*v1.Pod) error {
+	owned := deleteClaimsWith(pw)
+	for _, pod := range pods {
+		id := pod.Labels[workloadv1alpha1.InstanceIDLabelKey]
+		if id == "" {
+			continue
+		}
+		for i := range pw.Spec.VolumeClaimTemplates {
+			claim := &v1.PersistentVolumeClaim{}
+			key := client.ObjectKey{Namespace: pw.Namespace, Name: ClaimName(&pw.Spec.VolumeClaimTemplates[i], pw.Name, id)}
+			if err := r.Get(context.TODO(), key, claim); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+
+			var ownerRefs []metav1.OwnerReference
+			hasOwner := false
+			for _, ref := range claim.OwnerReferences {
+				if ref.UID == pw.UID {
+					hasOwner = true
+					continue
+				}
+				ownerRefs = append(ownerRefs, ref)
+			}
+			if hasOwner == owned {
+				continue
+			}
+			if owned {
+				ownerRefs = append(ownerRefs, claimOwnerRef(pw))
+			}
+
+			patch := client.MergeFrom(claim.DeepCopy())
+			claim.OwnerReferences = ownerRefs
+			if err := r.Patch(context.TODO(), claim, patch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteReleasedClaims deletes the claims of instance IDs released by a scale down if
+// spec.persistentVolumeClaimRetentionPolicy.whenScaled is Delete
+func (r *realSync) deleteReleasedClaims(pw *workloadv1alpha1.PartitionWorkload, ids []string) error {
+	policy := pw.Spec.PersistentVolumeClaimRetentionPolicy
+	if policy == nil || policy.WhenScaled != apps.DeletePersistentVolumeClaimRetentionPolicyType {
+		return nil
+	}
+	for _, id := range ids {
+		for i := range pw.Spec.VolumeClaimTemplates {
+			claim := &v1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: pw.Namespace,
+					Name:      ClaimName(&pw.Spec.VolumeClaimTemplates[i], pw.Name, id),
+				},
+			}
+			if err := r.Delete(context.TODO(), claim); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			klog.InfoS("Deleted PersistentVolumeClaim of released instance", "PartitionWorkload", klog.KObj(pw), "claim", klog.KObj(claim))
+		}
+	}
+	return nil
+}
+
+func deleteClaimsWith(pw *workloadv1alpha1.PartitionWorkload) bool {
+	policy := pw.Spec.PersistentVolumeClaimRetentionPolicy
+	return policy != nil && policy.WhenDeleted == apps.DeletePersistentVolumeClaimRetentionPolicyType
+}
+
+func claimOwnerRef(pw *workloadv1alpha1.PartitionWorkload) metav1.OwnerReference {
+	gvk := workloadv1alpha1.SchemeGroupVersion.WithKind("PartitionWorkload")
+	return metav1.OwnerReference{
+		APIVersion:         gvk.GroupVersion().String(),
+		Kind:               gvk.Kind,
+		Name:               pw.Name,
+		UID:                pw.UID,
+		BlockOwnerDeletion: ptr.To(true),
+	}
+}
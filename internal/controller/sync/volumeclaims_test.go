@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+func TestScaleAndUpdateVolumeClaims(t *testing.T) {
+	tests := []struct {
+		name             string
+		replicas         int32
+		partition        int32
+		retentionPolicy  *apps.StatefulSetPersistentVolumeClaimRetentionPolicy
+		existingIDs      []string
+		expectedClaims   []string
+		expectOwnerRef   bool
+		expectedPodClaim map[string]string
+	}{
+		{
+			name:           "Scale up creates the claims of new instances",
+			replicas:       2,
+			partition:      0,
+			expectedClaims: []string{"data-test-pw-0", "data-test-pw-1"},
+			expectedPodClaim: map[string]string{
+				"test-pw-1-0": "data-test-pw-0",
+				"test-pw-1-1": "data-test-pw-1",
+			},
+		},
+		{
+			name:           "Replacement pods mount the claim of the pod they replace",
+			replicas:       2,
+			partition:      1,
+			existingIDs:    []string{"0", "1"},
+			expectedClaims: []string{"data-test-pw-0", "data-test-pw-1"},
+			expectedPodClaim: map[string]string{
+				"test-pw-1-1": "data-test-pw-1",
+				"test-pw-2-0": "data-test-pw-0",
+			},
+		},
+		{
+			name:      "Scale down retains claims by default",
+			replicas:  1,
+			partition: 0,
+			existingIDs: []string{
+				"0", "1",
+			},
+			expectedClaims: []string{"data-test-pw-0", "data-test-pw-1"},
+			expectedPodClaim: map[string]string{
+				"test-pw-1-1": "data-test-pw-1",
+			},
+		},
+		{
+			name:      "Scale down deletes the claims of released instances with whenScaled=Delete",
+			replicas:  1,
+			partition: 0,
+			retentionPolicy: &apps.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenScaled: apps.DeletePersistentVolumeClaimRetentionPolicyType,
+			},
+			existingIDs:    []string{"0", "1"},
+			expectedClaims: []string{"data-test-pw-1"},
+			expectedPodClaim: map[string]string{
+				"test-pw-1-1": "data-test-pw-1",
+			},
+		},
+		{
+			name:      "Claims are owned by the PartitionWorkload with whenDeleted=Delete",
+			replicas:  2,
+			partition: 0,
+			retentionPolicy: &apps.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: apps.DeletePersistentVolumeClaimRetentionPolicyType,
+			},
+			existingIDs:    []string{"0"},
+			expectedClaims: []string{"data-test-pw-0", "data-test-pw-1"},
+			expectOwnerRef: true,
+			expectedPodClaim: map[string]string{
+				"test-pw-1-0": "data-test-pw-0",
+				"test-pw-1-1": "data-test-pw-1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeControl()
+			currentPW := getPW(tt.replicas)
+			currentPW.Spec.Partition = generalutil.Int32Ptr(tt.partition)
+			currentPW.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec: v1.PersistentVolumeClaimSpec{
+					AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				},
+			}}
+			currentPW.Spec.PersistentVolumeClaimRetentionPolicy = tt.retentionPolicy
+			updatedPW := currentPW.DeepCopy()
+			updatedPW.Spec.Template.Spec.Containers[0].Image = testUpdatedImage
+
+			// Existing claims are created without owners, like with the default retention policy
+			var pods []*v1.Pod
+			for i, id := range tt.existingIDs {
+				pod := NewVersionedPods(currentPW, revision1, 1)[0]
+				setInstanceID(pod, testPWName, id)
+				updatePodVolumes(currentPW, pod)
+				pod.CreationTimestamp = metav1.NewTime(time.Unix(int64(i), 0))
+				claim := newClaim(currentPW, &currentPW.Spec.VolumeClaimTemplates[0], id)
+				claim.OwnerReferences = nil
+				if err := r.Create(context.TODO(), claim); err != nil {
+					t.Fatalf("failed to create claim: %v", err)
+				}
+				if err := r.Create(context.TODO(), pod); err != nil {
+					t.Fatalf("failed to create pod: %v", err)
+				}
+				pods = append(pods, pod)
+			}
+
+			if err := r.ScaleAndUpdate(currentPW, updatedPW, revision1, revision2, pods); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			claimList := v1.PersistentVolumeClaimList{}
+			if err := r.List(context.TODO(), &claimList, client.InNamespace(v1.NamespaceDefault)); err != nil {
+				t.Fatalf("failed to list claims: %v", err)
+			}
+			var claims []string
+			for _, claim := range claimList.Items {
+				claims = append(claims, claim.Name)
+				if claim.Labels[workloadv1alpha1.InstanceIDLabelKey] == "" || claim.Labels["app"] != "test-app" {
+					t.Errorf("claim %s is missing labels: %v", claim.Name, claim.Labels)
+				}
+				hasOwnerRef := len(claim.OwnerReferences) == 1 && claim.OwnerReferences[0].UID == testUID
+				if hasOwnerRef != tt.expectOwnerRef {
+					t.Errorf("claim %s owner references = %v, expect owner %v", claim.Name, claim.OwnerReferences, tt.expectOwnerRef)
+				}
+			}
+			sort.Strings(claims)
+			if !slices.Equal(claims, tt.expectedClaims) {
+				t.Errorf("claims = %v, want %v", claims, tt.expectedClaims)
+			}
+
+			podList := v1.PodList{}
+			if err := r.List(context.TODO(), &podList, client.InNamespace(v1.NamespaceDefault)); err != nil {
+				t.Fatalf("failed to list pods: %v", err)
+			}
+			if len(podList.Items) != len(tt.expectedPodClaim) {
+				t.Fatalf("got %d pods, want %d", len(podList.Items), len(tt.expectedPodClaim))
+			}
+			for _, pod := range podList.Items {
+				expected, ok := tt.expectedPodClaim[pod.Name]
+				if !ok {
+					t.Errorf("unexpected pod %s", pod.Name)
+					continue
+				}
+				if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].PersistentVolumeClaim == nil ||
+					pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName != expected {
+					t.Errorf("pod %s volumes = %s, want claim %s", pod.Name, generalutil.DumpJSON(pod.Spec.Volumes), expected)
+				}
+			}
+		})
+	}
+}
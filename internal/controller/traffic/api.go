@@ -0,0 +1,21 @@
+package traffic
+
+import (
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type Interface interface {
+	SyncTraffic(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string, pods []*v1.Pod) error
+}
+
+type realTraffic struct {
+	client.Client
+}
+
+func NewTrafficControl(c client.Client) Interface {
+	return &realTraffic{
+		Client: c,
+	}
+}
@@ -0,0 +1,204 @@
+package traffic
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+const (
+	// maxWeight is the total weight split between the stable and canary backends
+	maxWeight = 100
+)
+
+var (
+	// HTTPRouteGVK is the Gateway API kind managed for traffic routing. It is accessed through unstructured
+	// objects so that the controller does not depend on the Gateway API go types.
+	HTTPRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+)
+
+// SyncTraffic points the stable and canary Services at the current and update revisions and sets the
+// backend weights of the HTTPRoute referenced by pw.Spec.TrafficRouting.
+//
+// Parameters:
+// - pw: PartitionWorkload whose traffic is managed. Nothing is done if it has no TrafficRouting.
+// - currentRevision: Name of the stable revision
+// - updateRevision: Name of the target revision
+// - pods: All active pods owned by this PartitionWorkload
+//
+// Returns:
+// - error: any error encountered while updating the Services or the HTTPRoute
+func (r *realTraffic) SyncTraffic(pw *workloadv1alpha1.PartitionWorkload, currentRevision, updateRevision string, pods []*v1.Pod) error {
+	routing := pw.Spec.TrafficRouting
+	if routing == nil || pw.DeletionTimestamp != nil {
+		return nil
+	}
+
+	if err := r.syncServiceSelector(pw.Namespace, routing.StableService, currentRevision); err != nil {
+		return err
+	}
+	if err := r.syncServiceSelector(pw.Namespace, routing.CanaryService, updateRevision); err != nil {
+		return err
+	}
+
+	canaryWeight := calculateCanaryWeight(routing, currentRevision, updateRevision, pods)
+	klog.InfoS("---- traffic update ----")
+	klog.InfoS("Calculated backend weights", "PartitionWorkload", klog.KObj(pw), "httpRoute", routing.HTTPRoute,
+		"stableWeight", maxWeight-canaryWeight, "canaryWeight", canaryWeight)
+
+	return r.syncRouteWeights(pw.Namespace, routing, maxWeight-canaryWeight, canaryWeight)
+}
+
+// calculateCanaryWeight returns the weight of the canary backend. When there is a single revision all
+// traffic goes to the stable backend. Otherwise the explicit CanaryWeight is used if set, and the
+// proportion of ready pods at the update revision if not.
+func calculateCanaryWeight(routing *workloadv1alpha1.TrafficRouting, currentRevision, updateRevision string, pods []*v1.Pod) int32 {
+	if currentRevision == updateRevision {
+		return 0
+	}
+	if routing.CanaryWeight != nil {
+		return *routing.CanaryWeight
+	}
+
+	var readyCurrent, readyUpdated int32
+	for _, pod := range pods {
+		if !podutil.IsPodReady(pod) {
+			continue
+		}
+		if generalutil.EqualToRevisionHash(pod, updateRevision) {
+			readyUpdated++
+		} else if generalutil.EqualToRevisionHash(pod, currentRevision) {
+			readyCurrent++
+		}
+	}
+	if readyCurrent+readyUpdated == 0 {
+		return 0
+	}
+	return readyUpdated * maxWeight / (readyCurrent + readyUpdated)
+}
+
+// syncServiceSelector makes the Service select pods with the pod-template-hash of the given revision.
+func (r *realTraffic) syncServiceSelector(namespace, name, revision string) error {
+	svc := &v1.Service{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, svc); err != nil {
+		return fmt.Errorf("failed to get service %s/%s: %v", namespace, name, err)
+	}
+	hash := generalutil.GetShortHash(revision)
+	if svc.Spec.Selector[apps.DefaultDeploymentUniqueLabelKey] == hash {
+		return nil
+	}
+	if svc.Spec.Selector == nil {
+		svc.Spec.Selector = make(map[string]string, 1)
+	}
+	svc.Spec.Selector[apps.DefaultDeploymentUniqueLabelKey] = hash
+	klog.InfoS("Updating service selector", "service", klog.KObj(svc), "revision", revision)
+	return r.Update(context.TODO(), svc)
+}
+
+// syncRouteWeights sets the weight of every backendRef of the HTTPRoute pointing at the stable or canary
+// Service. Rules that reference the stable Service but not the canary Service get a canary backendRef
+// on the same port, so users only have to declare the stable backend.
+func (r *realTraffic) syncRouteWeights(namespace string, routing *workloadv1alpha1.TrafficRouting, stableWeight, canaryWeight int32) error {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(HTTPRouteGVK)
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: routing.HTTPRoute}, route); err != nil {
+		return fmt.Errorf("failed to get httproute %s/%s: %v", namespace, routing.HTTPRoute, err)
+	}
+
+	rules, found, err := unstructured.NestedSlice(route.Object, "spec", "rules")
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("httproute %s/%s has no rules", namespace, routing.HTTPRoute)
+	}
+
+	newRules := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			newRules = append(newRules, rule)
+			continue
+		}
+		ruleCopy := make(map[string]interface{}, len(ruleMap))
+		for k, v := range ruleMap {
+			ruleCopy[k] = v
+		}
+		ruleCopy["backendRefs"] = setBackendWeights(ruleMap["backendRefs"], routing, stableWeight, canaryWeight)
+		newRules = append(newRules, ruleCopy)
+	}
+
+	if reflect.DeepEqual(rules, newRules) {
+		return nil
+	}
+	if err := unstructured.SetNestedSlice(route.Object, newRules, "spec", "rules"); err != nil {
+		return err
+	}
+	klog.InfoS("Updating httproute backend weights", "httpRoute", klog.KObj(route), "stableWeight", stableWeight, "canaryWeight", canaryWeight)
+	return r.Update(context.TODO(), route)
+}
+
+func setBackendWeights(backendRefs interface{}, routing *workloadv1alpha1.TrafficRouting, stableWeight, canaryWeight int32) interface{} {
+	refs, ok := backendRefs.([]interface{})
+	if !ok {
+		return backendRefs
+	}
+
+	var stableRef map[string]interface{}
+	var hasCanary bool
+	newRefs := make([]interface{}, 0, len(refs)+1)
+	for _, ref := range refs {
+		refMap, ok := ref.(map[string]interface{})
+		if !ok || !isServiceRef(refMap) {
+			newRefs = append(newRefs, ref)
+			continue
+		}
+		refCopy := make(map[string]interface{}, len(refMap))
+		for k, v := range refMap {
+			refCopy[k] = v
+		}
+		switch refMap["name"] {
+		case routing.StableService:
+			refCopy["weight"] = int64(stableWeight)
+			stableRef = refCopy
+		case routing.CanaryService:
+			refCopy["weight"] = int64(canaryWeight)
+			hasCanary = true
+		}
+		newRefs = append(newRefs, refCopy)
+	}
+
+	if stableRef != nil && !hasCanary {
+		canaryRef := map[string]interface{}{
+			"name":   routing.CanaryService,
+			"weight": int64(canaryWeight),
+		}
+		if port, ok := stableRef["port"]; ok {
+			canaryRef["port"] = port
+		}
+		newRefs = append(newRefs, canaryRef)
+	}
+	return newRefs
+}
+
+// isServiceRef returns true if the backendRef points at a core Service, which is the default kind.
+func isServiceRef(ref map[string]interface{}) bool {
+	if group, ok := ref["group"]; ok && group != "" {
+		return false
+	}
+	if kind, ok := ref["kind"]; ok && kind != "Service" {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,248 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	generalutil "github.com/2170chm/k8s-partition-workload/internal/util/general"
+)
+
+const (
+	testPWName        = "test-pw"
+	testRouteName     = "test-route"
+	testStableService = "test-stable"
+	testCanaryService = "test-canary"
+	currentRevision   = "test-pw-1111"
+	updateRevision    = "test-pw-2222"
+)
+
+func TestCalculateCanaryWeight(t *testing.T) {
+	tests := []struct {
+		name            string
+		canaryWeight    *int32
+		currentRevision string
+		updateRevision  string
+		pods            []*v1.Pod
+		expectedWeight  int32
+	}{
+		{
+			name:            "Single revision sends all traffic to stable",
+			currentRevision: currentRevision,
+			updateRevision:  currentRevision,
+			pods:            []*v1.Pod{newPod("a", currentRevision, true)},
+			expectedWeight:  0,
+		},
+		{
+			name:            "Weight follows ready pods",
+			currentRevision: currentRevision,
+			updateRevision:  updateRevision,
+			pods: []*v1.Pod{
+				newPod("a", currentRevision, true),
+				newPod("b", currentRevision, true),
+				newPod("c", currentRevision, true),
+				newPod("d", updateRevision, true),
+				newPod("e", updateRevision, false),
+			},
+			expectedWeight: 25,
+		},
+		{
+			name:            "Stale revisions are not counted",
+			currentRevision: currentRevision,
+			updateRevision:  updateRevision,
+			pods: []*v1.Pod{
+				newPod("a", currentRevision, true),
+				newPod("b", "test-pw-3333", true),
+				newPod("c", updateRevision, true),
+			},
+			expectedWeight: 50,
+		},
+		{
+			name:            "No ready pods",
+			currentRevision: currentRevision,
+			updateRevision:  updateRevision,
+			pods:            []*v1.Pod{newPod("a", updateRevision, false)},
+			expectedWeight:  0,
+		},
+		{
+			name:            "Explicit weight overrides ready pods",
+			canaryWeight:    generalutil.Int32Ptr(10),
+			currentRevision: currentRevision,
+			updateRevision:  updateRevision,
+			pods:            []*v1.Pod{newPod("a", updateRevision, true)},
+			expectedWeight:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routing := newTrafficRouting()
+			routing.CanaryWeight = tt.canaryWeight
+			got := calculateCanaryWeight(routing, tt.currentRevision, tt.updateRevision, tt.pods)
+			if got != tt.expectedWeight {
+				t.Errorf("calculateCanaryWeight() = %d, want %d", got, tt.expectedWeight)
+			}
+		})
+	}
+}
+
+func TestSyncTraffic(t *testing.T) {
+	pw := getPW()
+	stable := newService(testStableService)
+	canary := newService(testCanaryService)
+	route := newHTTPRoute()
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workloadv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(stable, canary, route).Build()
+	r := &realTraffic{Client: c}
+
+	pods := []*v1.Pod{
+		newPod("a", currentRevision, true),
+		newPod("b", updateRevision, true),
+	}
+	if err := r.SyncTraffic(pw, currentRevision, updateRevision, pods); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	for name, revision := range map[string]string{testStableService: currentRevision, testCanaryService: updateRevision} {
+		svc := &v1.Service{}
+		if err := c.Get(context.TODO(), types.NamespacedName{Namespace: v1.NamespaceDefault, Name: name}, svc); err != nil {
+			t.Fatalf("failed to get service: %v", err)
+		}
+		if svc.Spec.Selector["app"] != "test-app" {
+			t.Errorf("service %s lost its existing selector: %v", name, svc.Spec.Selector)
+		}
+		if got := svc.Spec.Selector[apps.DefaultDeploymentUniqueLabelKey]; got != generalutil.GetShortHash(revision) {
+			t.Errorf("service %s selects hash %s, want %s", name, got, generalutil.GetShortHash(revision))
+		}
+	}
+
+	got := &unstructured.Unstructured{}
+	got.SetGroupVersionKind(HTTPRouteGVK)
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: v1.NamespaceDefault, Name: testRouteName}, got); err != nil {
+		t.Fatalf("failed to get httproute: %v", err)
+	}
+	rules, _, _ := unstructured.NestedSlice(got.Object, "spec", "rules")
+	refs := rules[0].(map[string]interface{})["backendRefs"].([]interface{})
+	if len(refs) != 2 {
+		t.Fatalf("expected a canary backendRef to be added, got %v", refs)
+	}
+	expected := map[string]int64{testStableService: 50, testCanaryService: 50}
+	for _, ref := range refs {
+		refMap := ref.(map[string]interface{})
+		name := refMap["name"].(string)
+		if refMap["weight"] != expected[name] {
+			t.Errorf("backendRef %s has weight %v, want %d", name, refMap["weight"], expected[name])
+		}
+		if refMap["port"] != int64(80) {
+			t.Errorf("backendRef %s has port %v, want 80", name, refMap["port"])
+		}
+	}
+
+	// Once the rollout completes all traffic goes back to the stable backend
+	if err := r.SyncTraffic(pw, updateRevision, updateRevision, pods); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: v1.NamespaceDefault, Name: testRouteName}, got); err != nil {
+		t.Fatalf("failed to get httproute: %v", err)
+	}
+	rules, _, _ = unstructured.NestedSlice(got.Object, "spec", "rules")
+	for _, ref := range rules[0].(map[string]interface{})["backendRefs"].([]interface{}) {
+		refMap := ref.(map[string]interface{})
+		if refMap["name"] == testCanaryService && refMap["weight"] != int64(0) {
+			t.Errorf("canary backendRef has weight %v after rollout completed, want 0", refMap["weight"])
+		}
+	}
+}
+
+func TestSyncTrafficWithoutRouting(t *testing.T) {
+	pw := getPW()
+	pw.Spec.TrafficRouting = nil
+	r := &realTraffic{Client: fake.NewClientBuilder().Build()}
+	if err := r.SyncTraffic(pw, currentRevision, updateRevision, nil); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+}
+
+func getPW() *workloadv1alpha1.PartitionWorkload {
+	return &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: v1.NamespaceDefault,
+			Name:      testPWName,
+		},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Replicas:       generalutil.Int32Ptr(2),
+			TrafficRouting: newTrafficRouting(),
+		},
+	}
+}
+
+func newTrafficRouting() *workloadv1alpha1.TrafficRouting {
+	return &workloadv1alpha1.TrafficRouting{
+		HTTPRoute:     testRouteName,
+		StableService: testStableService,
+		CanaryService: testCanaryService,
+	}
+}
+
+func newPod(name, revision string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: v1.NamespaceDefault,
+			Name:      name,
+			Labels:    map[string]string{apps.ControllerRevisionHashLabelKey: revision},
+		},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
+
+func newService(name string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: v1.NamespaceDefault,
+			Name:      name,
+		},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"app": "test-app"},
+		},
+	}
+}
+
+func newHTTPRoute() client.Object {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{
+					"backendRefs": []interface{}{
+						map[string]interface{}{
+							"name": testStableService,
+							"port": int64(80),
+						},
+					},
+				},
+			},
+		},
+	}}
+	route.SetGroupVersionKind(HTTPRouteGVK)
+	route.SetNamespace(v1.NamespaceDefault)
+	route.SetName(testRouteName)
+	return route
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	apps "k8s.io/api/apps/v1"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+func newHistoryCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "history NAME",
+		Short: "List the revisions of a PartitionWorkload with their change causes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := o.getWorkload(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			revisions, err := o.listRevisions(cmd.Context(), pw)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(o.out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "REVISION\tNAME\tROLE\tCREATED\tCOMPLETED\tCHANGE-CAUSE")
+			for _, revision := range revisions {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", revision.Revision, revision.Name,
+					revisionRole(revision.Name, pw.Status.CurrentRevision, pw.Status.UpdateRevision),
+					revision.CreationTimestamp.UTC().Format("2006-01-02T15:04:05Z"),
+					orNone(revision.Annotations[workloadv1alpha1.CompletedAtAnnotationKey]),
+					orNone(revision.Annotations[workloadv1alpha1.ChangeCauseAnnotationKey]))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newDiffCommand(o *options) *cobra.Command {
+	var from, to int64
+	cmd := &cobra.Command{
+		Use:   "diff NAME",
+		Short: "Show the changes to the pod template between two revisions",
+		Long: "Show the changes to the pod template between two revisions, by default from the current revision\n" +
+			"to the update revision.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := o.getWorkload(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			revisions, err := o.listRevisions(cmd.Context(), pw)
+			if err != nil {
+				return err
+			}
+			fromRevision, err := findRevision(revisions, from, pw.Status.CurrentRevision)
+			if err != nil {
+				return err
+			}
+			toRevision, err := findRevision(revisions, to, pw.Status.UpdateRevision)
+			if err != nil {
+				return err
+			}
+
+			diff, err := o.revisions.DiffRevisions(pw, fromRevision, toRevision)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "%s → %s\n", describeRevision(fromRevision), describeRevision(toRevision))
+			if len(diff.Changes) == 0 {
+				fmt.Fprintf(o.out, "  %s\n", diff.String())
+			}
+			for _, change := range diff.Changes {
+				fmt.Fprintf(o.out, "  %s\n", change.String())
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&from, "from", 0, "The revision to compare from. Defaults to the current revision")
+	cmd.Flags().Int64Var(&to, "to", 0, "The revision to compare to. Defaults to the update revision")
+	return cmd
+}
+
+func describeRevision(revision *apps.ControllerRevision) string {
+	return fmt.Sprintf("revision %d (%s)", revision.Revision, revision.Name)
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
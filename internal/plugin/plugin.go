@@ -0,0 +1,175 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/kubernetes/pkg/controller/history"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/revision"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(workloadv1alpha1.AddToScheme(scheme))
+}
+
+// options are shared by all commands. The client is built from the kubeconfig flags before a command runs,
+// unless one is set already.
+type options struct {
+	kubeconfig string
+	context    string
+	namespace  string
+
+	client    client.Client
+	revisions revision.Interface
+	out       io.Writer
+}
+
+// NewCommand returns the root command of the kubectl partition plugin
+func NewCommand() *cobra.Command {
+	return newCommand(&options{})
+}
+
+func newCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "kubectl-partition",
+		Short:        "Inspect and operate rollouts of PartitionWorkloads",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			o.out = cmd.OutOrStdout()
+			return o.complete()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use")
+	cmd.PersistentFlags().StringVar(&o.context, "context", "", "The name of the kubeconfig context to use")
+	cmd.PersistentFlags().StringVarP(&o.namespace, "namespace", "n", o.namespace, "The namespace of the PartitionWorkload")
+
+	cmd.AddCommand(
+		newStatusCommand(o),
+		newPromoteCommand(o),
+		newSetPartitionCommand(o),
+		newPauseCommand(o, true),
+		newPauseCommand(o, false),
+		newRollbackCommand(o),
+		newHistoryCommand(o),
+		newDiffCommand(o),
+	)
+	return cmd
+}
+
+// complete builds the client from the kubeconfig, and defaults the namespace to the one of its context
+func (o *options) complete() error {
+	if o.client != nil {
+		if o.revisions == nil {
+			o.revisions = revision.NewRevisionControl(o.client, scheme)
+		}
+		return nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: o.context})
+	if o.namespace == "" {
+		namespace, _, err := config.Namespace()
+		if err != nil {
+			return err
+		}
+		o.namespace = namespace
+	}
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return err
+	}
+	if o.client, err = client.New(restConfig, client.Options{Scheme: scheme}); err != nil {
+		return err
+	}
+	o.revisions = revision.NewRevisionControl(o.client, scheme)
+	return nil
+}
+
+func (o *options) getWorkload(ctx context.Context, name string) (*workloadv1alpha1.PartitionWorkload, error) {
+	pw := &workloadv1alpha1.PartitionWorkload{}
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, pw); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// patchWorkload applies the changes made by mutate to pw with a merge patch
+func (o *options) patchWorkload(ctx context.Context, pw *workloadv1alpha1.PartitionWorkload,
+	mutate func(*workloadv1alpha1.PartitionWorkload),
+) error {
+	updated := pw.DeepCopy()
+	mutate(updated)
+	if err := o.client.Patch(ctx, updated, client.MergeFrom(pw)); err != nil {
+		return err
+	}
+	*pw = *updated
+	return nil
+}
+
+// listRevisions returns the ControllerRevisions controlled by pw, oldest first
+func (o *options) listRevisions(ctx context.Context, pw *workloadv1alpha1.PartitionWorkload) ([]*apps.ControllerRevision, error) {
+	selector, err := metav1.LabelSelectorAsSelector(pw.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &apps.ControllerRevisionList{}
+	if err := o.client.List(ctx, list, client.InNamespace(pw.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	var revisions []*apps.ControllerRevision
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], pw) {
+			revisions = append(revisions, &list.Items[i])
+		}
+	}
+	history.SortControllerRevisions(revisions)
+	return revisions, nil
+}
+
+// listPods returns the active pods controlled by pw
+func (o *options) listPods(ctx context.Context, pw *workloadv1alpha1.PartitionWorkload) ([]*v1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(pw.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &v1.PodList{}
+	if err := o.client.List(ctx, list, client.InNamespace(pw.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	var pods []*v1.Pod
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], pw) && list.Items[i].DeletionTimestamp == nil {
+			pods = append(pods, &list.Items[i])
+		}
+	}
+	return pods, nil
+}
+
+// findRevision returns the revision with the given number, or the one with the given name if number is 0
+func findRevision(revisions []*apps.ControllerRevision, number int64, name string) (*apps.ControllerRevision, error) {
+	for _, revision := range revisions {
+		if (number != 0 && revision.Revision == number) || (number == 0 && revision.Name == name) {
+			return revision, nil
+		}
+	}
+	if number != 0 {
+		return nil, fmt.Errorf("revision %d not found", number)
+	}
+	return nil, fmt.Errorf("revision %s not found", name)
+}
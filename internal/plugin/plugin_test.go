@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/revision"
+)
+
+const testName = "web"
+
+func TestCommands(t *testing.T) {
+	o, first, second := newTestOptions(t)
+
+	out := run(t, o, "status", testName)
+	for _, want := range []string{
+		"Partition:  1 of 2 replicas",
+		"[###############---------------] 1/2 updated",
+		"2         " + second.Name + "  1     1      update",
+		"1         " + first.Name + "  1     0      current",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("status output is missing %q:\n%s", want, out)
+		}
+	}
+
+	if out := run(t, o, "diff", testName); !strings.Contains(out, "image nginx:1.25 → 1.27") {
+		t.Errorf("diff output is missing the image change:\n%s", out)
+	}
+	if out := run(t, o, "history", testName); !strings.Contains(out, "scale image") || !strings.Contains(out, first.Name) {
+		t.Errorf("history output is missing revisions:\n%s", out)
+	}
+
+	run(t, o, "set-partition", testName, "50%")
+	if pw := getWorkload(t, o); ptr.Deref(pw.Spec.Partition, 0) != 1 {
+		t.Errorf("want partition 1 got %v", ptr.Deref(pw.Spec.Partition, 0))
+	}
+	run(t, o, "promote", testName)
+	if pw := getWorkload(t, o); ptr.Deref(pw.Spec.Partition, 0) != 2 {
+		t.Errorf("want partition 2 got %v", ptr.Deref(pw.Spec.Partition, 0))
+	}
+	run(t, o, "pause", testName)
+	if pw := getWorkload(t, o); !pw.Spec.Paused {
+		t.Errorf("expected the workload to be paused")
+	}
+	run(t, o, "resume", testName)
+	if pw := getWorkload(t, o); pw.Spec.Paused {
+		t.Errorf("expected the workload to be resumed")
+	}
+
+	if out := run(t, o, "rollback", testName); !strings.Contains(out, "rolled back to revision 1") {
+		t.Errorf("unexpected rollback output:\n%s", out)
+	}
+	if image := getWorkload(t, o).Spec.Template.Spec.Containers[0].Image; image != "nginx:1.25" {
+		t.Errorf("want image nginx:1.25 after the rollback got %s", image)
+	}
+	if _, err := execute(o, "rollback", testName, "--to-revision", "5"); err == nil {
+		t.Errorf("expected an error rolling back to a missing revision")
+	}
+}
+
+func TestParsePartition(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int32
+		wantErr bool
+	}{
+		{value: "3", want: 3},
+		{value: "0", want: 0},
+		{value: "50%", want: 5},
+		{value: "1%", want: 1},
+		{value: "100%", want: 10},
+		{value: "11", wantErr: true},
+		{value: "150%", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "half", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePartition(tt.value, 10)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: want error %v got %v", tt.value, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: want %d got %d", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	if got := progressBar(1, 4, 8); got != "[##------]" {
+		t.Errorf("want [##------] got %s", got)
+	}
+	if got := progressBar(5, 4, 4); got != "[####]" {
+		t.Errorf("want a full bar when done exceeds total, got %s", got)
+	}
+	if got := progressBar(0, 0, 4); got != "[####]" {
+		t.Errorf("want a full bar without replicas, got %s", got)
+	}
+}
+
+// newTestOptions returns options with a fake client holding a workload rolling out from nginx:1.25 to 1.27,
+// with one pod at each revision
+func newTestOptions(t *testing.T) (*options, *apps.ControllerRevision, *apps.ControllerRevision) {
+	labels := map[string]string{"app": testName}
+	pw := &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{Namespace: v1.NamespaceDefault, Name: testName, UID: "web-uid"},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Replicas:  ptr.To[int32](2),
+			Partition: ptr.To[int32](1),
+			Selector:  &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "nginx", Image: "nginx:1.25"}}},
+			},
+		},
+	}
+	revisions := revision.NewRevisionControl(nil, scheme)
+	first, err := revisions.NewRevision(pw, 1, ptr.To[int32](0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Spec.Template.Spec.Containers[0].Image = "nginx:1.27"
+	pw.Annotations = map[string]string{workloadv1alpha1.ChangeCauseAnnotationKey: "scale image"}
+	second, err := revisions.NewRevision(pw, 2, ptr.To[int32](0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Status = workloadv1alpha1.PartitionWorkloadStatus{
+		Replicas: 2, ReadyReplicas: 1, UpdatedReplicas: 1,
+		CurrentRevision: first.Name, UpdateRevision: second.Name,
+	}
+
+	objs := []client.Object{pw, first, second}
+	for _, revision := range []*apps.ControllerRevision{first, second} {
+		revision.Namespace = v1.NamespaceDefault
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       v1.NamespaceDefault,
+			Name:            revision.Name + "-pod",
+			Labels:          map[string]string{"app": testName, apps.ControllerRevisionHashLabelKey: revision.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(pw, workloadv1alpha1.GroupVersion.WithKind("PartitionWorkload"))},
+		}}
+		if revision == second {
+			pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+		}
+		objs = append(objs, pod)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	return &options{client: c, namespace: v1.NamespaceDefault}, first, second
+}
+
+func execute(o *options, args ...string) (string, error) {
+	cmd := newCommand(o)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.ExecuteContext(context.TODO())
+	return out.String(), err
+}
+
+func run(t *testing.T, o *options, args ...string) string {
+	t.Helper()
+	out, err := execute(o, args...)
+	if err != nil {
+		t.Fatalf("%v failed: %v\n%s", args, err, out)
+	}
+	return out
+}
+
+func getWorkload(t *testing.T, o *options) *workloadv1alpha1.PartitionWorkload {
+	t.Helper()
+	pw := &workloadv1alpha1.PartitionWorkload{}
+	if err := o.client.Get(context.TODO(), client.ObjectKey{Namespace: v1.NamespaceDefault, Name: testName}, pw); err != nil {
+		t.Fatal(err)
+	}
+	return pw
+}
@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+)
+
+func newPromoteCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "promote NAME",
+		Short: "Move all replicas to the update revision by setting the partition to the replicas",
+		Long: "Move all replicas to the update revision by setting the partition to the replicas. The partition\n" +
+			"is not raised when the workload is scaled later.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := o.getWorkload(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			replicas := ptr.Deref(pw.Spec.Replicas, 1)
+			if err := o.patchWorkload(cmd.Context(), pw, func(pw *workloadv1alpha1.PartitionWorkload) {
+				pw.Spec.Partition = ptr.To(replicas)
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "partitionworkload/%s promoted, partition set to %d\n", pw.Name, replicas)
+			if pw.Spec.Paused {
+				fmt.Fprintf(o.out, "partitionworkload/%s is paused, resume it to continue the rollout\n", pw.Name)
+			}
+			return nil
+		},
+	}
+}
+
+func newSetPartitionCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set-partition NAME N|P%",
+		Short: "Set the number of replicas at the update revision, as a count or a percentage of the replicas",
+		Long: "Set the number of replicas at the update revision, as a count or a percentage of the replicas.\n" +
+			"Percentages are rounded up, so any percentage above zero moves at least one replica.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := o.getWorkload(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			partition, err := parsePartition(args[1], ptr.Deref(pw.Spec.Replicas, 1))
+			if err != nil {
+				return err
+			}
+			if err := o.patchWorkload(cmd.Context(), pw, func(pw *workloadv1alpha1.PartitionWorkload) {
+				pw.Spec.Partition = ptr.To(partition)
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "partitionworkload/%s partition set to %d\n", pw.Name, partition)
+			return nil
+		},
+	}
+}
+
+// parsePartition parses a partition given as a count or as a percentage of replicas, rounded up
+func parsePartition(value string, replicas int32) (int32, error) {
+	var partition intstr.IntOrString
+	if strings.HasSuffix(value, "%") {
+		partition = intstr.FromString(value)
+	} else {
+		count, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid partition %q, must be a count or a percentage", value)
+		}
+		partition = intstr.FromInt32(int32(count))
+	}
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(&partition, int(replicas), true)
+	if err != nil {
+		return 0, fmt.Errorf("invalid partition %q: %w", value, err)
+	}
+	if scaled < 0 || scaled > int(replicas) {
+		return 0, fmt.Errorf("partition %q must be between 0 and the %d replicas", value, replicas)
+	}
+	return int32(scaled), nil
+}
+
+func newPauseCommand(o *options, paused bool) *cobra.Command {
+	use, short, done := "pause NAME", "Stop moving pods to the update revision", "paused"
+	if !paused {
+		use, short, done = "resume NAME", "Continue moving pods to the update revision", "resumed"
+	}
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := o.getWorkload(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if pw.Spec.Paused == paused {
+				fmt.Fprintf(o.out, "partitionworkload/%s is already %s\n", pw.Name, done)
+				return nil
+			}
+			if err := o.patchWorkload(cmd.Context(), pw, func(pw *workloadv1alpha1.PartitionWorkload) {
+				pw.Spec.Paused = paused
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "partitionworkload/%s %s\n", pw.Name, done)
+			return nil
+		},
+	}
+}
+
+func newRollbackCommand(o *options) *cobra.Command {
+	var toRevision int64
+	cmd := &cobra.Command{
+		Use:   "rollback NAME",
+		Short: "Restore the pod template of a previous revision",
+		Long: "Restore the pod template of a previous revision, by default the one before the update revision.\n" +
+			"The restored revision becomes the update revision and is rolled out up to the partition.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pw, err := o.getWorkload(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			revisions, err := o.listRevisions(cmd.Context(), pw)
+			if err != nil {
+				return err
+			}
+			target, err := rollbackTarget(revisions, pw.Status.UpdateRevision, toRevision)
+			if err != nil {
+				return err
+			}
+			if target.Name == pw.Status.UpdateRevision {
+				fmt.Fprintf(o.out, "partitionworkload/%s is already at revision %d\n", pw.Name, target.Revision)
+				return nil
+			}
+
+			restored, err := o.revisions.ApplyRevision(pw, target)
+			if err != nil {
+				return err
+			}
+			if err := o.patchWorkload(cmd.Context(), pw, func(pw *workloadv1alpha1.PartitionWorkload) {
+				pw.Spec.Template = restored.Spec.Template
+			}); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.out, "partitionworkload/%s rolled back to revision %d\n", pw.Name, target.Revision)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&toRevision, "to-revision", 0, "The revision to roll back to. Defaults to the one before the update revision")
+	return cmd
+}
+
+// rollbackTarget returns the revision with the given number, or the newest revision older than the update revision
+// if number is 0. Revisions are sorted oldest first.
+func rollbackTarget(revisions []*apps.ControllerRevision, updateRevision string, number int64) (*apps.ControllerRevision, error) {
+	if number != 0 {
+		return findRevision(revisions, number, "")
+	}
+	update, err := findRevision(revisions, 0, updateRevision)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Revision < update.Revision {
+			return revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no revision before revision %d to roll back to", update.Revision)
+}
@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+
+	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/condition"
+)
+
+// progressBarWidth is the number of characters between the brackets of the progress bar
+const progressBarWidth = 30
+
+func newStatusCommand(o *options) *cobra.Command {
+	var watch bool
+	var interval time.Duration
+	cmd := &cobra.Command{
+		Use:   "status NAME",
+		Short: "Show the progress of a rollout and the pods at each revision",
+		Long: "Show the progress of a rollout and the pods at each revision. With --watch the status is shown again\n" +
+			"whenever it changes, until the rollout completes.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if !watch {
+				report, _, err := o.status(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				_, err = io.WriteString(o.out, report)
+				return err
+			}
+
+			var last string
+			return wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+				report, complete, err := o.status(ctx, args[0])
+				if err != nil {
+					return false, err
+				}
+				if report != last {
+					if last != "" {
+						fmt.Fprintln(o.out)
+					}
+					if _, err := io.WriteString(o.out, report); err != nil {
+						return false, err
+					}
+					last = report
+				}
+				return complete, nil
+			})
+		},
+	}
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep showing the status until the rollout completes")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "How often the status is refreshed with --watch")
+	return cmd
+}
+
+// revisionCount is the number of pods at a revision
+type revisionCount struct {
+	name     string
+	revision int64
+	pods     int
+	ready    int
+}
+
+// status renders the status of the named PartitionWorkload and returns whether its rollout is complete
+func (o *options) status(ctx context.Context, name string) (string, bool, error) {
+	pw, err := o.getWorkload(ctx, name)
+	if err != nil {
+		return "", false, err
+	}
+	revisions, err := o.listRevisions(ctx, pw)
+	if err != nil {
+		return "", false, err
+	}
+	pods, err := o.listPods(ctx, pw)
+	if err != nil {
+		return "", false, err
+	}
+	return renderStatus(pw, revisions, pods), rolloutComplete(pw), nil
+}
+
+// rolloutComplete returns true if the controller has observed the latest spec of pw and reports it as rolled out
+func rolloutComplete(pw *workloadv1alpha1.PartitionWorkload) bool {
+	cond := condition.GetCondition(pw.Status, workloadv1alpha1.PartitionWorkloadConditionRolloutComplete)
+	return pw.Status.ObservedGeneration >= pw.Generation && cond != nil && cond.Status == metav1.ConditionTrue
+}
+
+func renderStatus(pw *workloadv1alpha1.PartitionWorkload, revisions []*apps.ControllerRevision, pods []*v1.Pod) string {
+	replicas := int32(1)
+	if pw.Spec.Replicas != nil {
+		replicas = *pw.Spec.Replicas
+	}
+	partition := replicas
+	if pw.Spec.Partition != nil && *pw.Spec.Partition < replicas {
+		partition = *pw.Spec.Partition
+	}
+	status := pw.Status
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "PartitionWorkload %s/%s\n", pw.Namespace, pw.Name)
+	fmt.Fprintf(&buf, "Revisions:  update %s, current %s\n", status.UpdateRevision, status.CurrentRevision)
+	state := ""
+	if pw.Spec.Paused {
+		state = ", paused"
+	}
+	fmt.Fprintf(&buf, "Partition:  %d of %d replicas%s\n", partition, replicas, state)
+	fmt.Fprintf(&buf, "Progress:   %s %d/%d updated, %d/%d ready, %d/%d available\n",
+		progressBar(status.UpdatedReplicas, replicas, progressBarWidth), status.UpdatedReplicas, replicas,
+		status.ReadyReplicas, replicas, status.AvailableReplicas, replicas)
+	if pw.Status.ObservedGeneration < pw.Generation {
+		fmt.Fprintf(&buf, "Waiting for the controller to observe generation %d\n", pw.Generation)
+	}
+
+	fmt.Fprintln(&buf)
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tNAME\tPODS\tREADY\tROLE")
+	for _, count := range countPods(revisions, pods, status.CurrentRevision, status.UpdateRevision) {
+		number := "<unknown>"
+		if count.revision != 0 {
+			number = fmt.Sprint(count.revision)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", number, count.name, count.pods, count.ready,
+			revisionRole(count.name, status.CurrentRevision, status.UpdateRevision))
+	}
+	_ = w.Flush()
+
+	if len(status.Conditions) > 0 {
+		fmt.Fprintln(&buf)
+		w = tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CONDITION\tSTATUS\tREASON\tMESSAGE")
+		for _, cond := range status.Conditions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+		}
+		_ = w.Flush()
+	}
+	return buf.String()
+}
+
+// countPods counts the pods and ready pods at each revision, newest revision first. The update and current
+// revisions are listed even without pods, as are pods at revisions that no longer exist.
+func countPods(revisions []*apps.ControllerRevision, pods []*v1.Pod, currentRevision, updateRevision string) []revisionCount {
+	counts := map[string]*revisionCount{}
+	var order []string
+	for i := len(revisions) - 1; i >= 0; i-- {
+		counts[revisions[i].Name] = &revisionCount{name: revisions[i].Name, revision: revisions[i].Revision}
+		order = append(order, revisions[i].Name)
+	}
+	for _, pod := range pods {
+		hash := pod.Labels[apps.ControllerRevisionHashLabelKey]
+		count, ok := counts[hash]
+		if !ok {
+			count = &revisionCount{name: hash}
+			counts[hash] = count
+			order = append(order, hash)
+		}
+		count.pods++
+		if podutil.IsPodReady(pod) {
+			count.ready++
+		}
+	}
+
+	var result []revisionCount
+	for _, name := range order {
+		if counts[name].pods > 0 || name == currentRevision || name == updateRevision {
+			result = append(result, *counts[name])
+		}
+	}
+	return result
+}
+
+func revisionRole(name, currentRevision, updateRevision string) string {
+	var roles []string
+	if name == updateRevision {
+		roles = append(roles, "update")
+	}
+	if name == currentRevision {
+		roles = append(roles, "current")
+	}
+	if len(roles) == 0 {
+		return "-"
+	}
+	return strings.Join(roles, ",")
+}
+
+// progressBar renders done out of total as a bar of the given width, e.g. [#####-----]
+func progressBar(done, total int32, width int) string {
+	filled := width
+	if total > 0 {
+		filled = int(int64(done) * int64(width) / int64(total))
+	}
+	filled = min(max(filled, 0), width)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
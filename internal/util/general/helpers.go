@@ -3,6 +3,7 @@ package general
 import (
 	"encoding/json"
 	"sort"
+	"strings"
 	"sync"
 
 	apps "k8s.io/api/apps/v1"
@@ -63,6 +64,13 @@ func EqualToRevisionHash(pod *v1.Pod, hash string) bool {
 	return pod.GetLabels()[apps.ControllerRevisionHashLabelKey] == hash
 }
 
+// GetShortHash returns the hash part of a revision name, which is always the last '-' substring.
+// It is the value written to the pod-template-hash label.
+func GetShortHash(revision string) string {
+	list := strings.Split(revision, "-")
+	return list[len(list)-1]
+}
+
 func Int32Ptr(i int32) *int32 {
 	return &i
 }
@@ -4,33 +4,92 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
 
 	apps "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/util/retry"
 	history "k8s.io/kubernetes/pkg/controller/history"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
+// ListControllerRevisions returns the revisions controlled by parent that match selector. Like the claiming of
+// pods by RefManager, orphaned revisions that match are adopted and controlled revisions that no longer match
+// are released, unless parent is being deleted. Revisions are named after their parent by ControllerRevisionName,
+// so orphans are only adopted if their name is "<parent name>-<hash>". This keeps the history of a
+// PartitionWorkload deleted with --cascade=orphan and recreated.
 func (rh *realHistory) ListControllerRevisions(parent metav1.Object, selector labels.Selector) ([]*apps.ControllerRevision, error) {
-	// List all revisions in the namespace that match the selector
+	// List all revisions in the namespace, as those we control may no longer match the selector
 	revisions := apps.ControllerRevisionList{}
-	err := rh.List(context.TODO(), &revisions, &client.ListOptions{Namespace: parent.GetNamespace(), LabelSelector: selector})
+	err := rh.List(context.TODO(), &revisions, &client.ListOptions{Namespace: parent.GetNamespace()})
 	if err != nil {
 		return nil, err
 	}
-	var owned []*apps.ControllerRevision
+
+	var parentKind *schema.GroupVersionKind
+	var claimed []*apps.ControllerRevision
+	var errlist []error
 	for i := range revisions.Items {
-		ref := metav1.GetControllerOf(&revisions.Items[i])
-		if ref != nil && ref.UID == parent.GetUID() {
-			owned = append(owned, &revisions.Items[i])
+		revision := &revisions.Items[i]
+		match := selector.Matches(labels.Set(revision.Labels))
+
+		ref := metav1.GetControllerOf(revision)
+		if ref != nil {
+			if ref.UID != parent.GetUID() {
+				// Owned by someone else. Ignore.
+				continue
+			}
+			if match || parent.GetDeletionTimestamp() != nil {
+				claimed = append(claimed, revision)
+				continue
+			}
+			// Owned by us but selector doesn't match. Try to release.
+			if _, err := rh.ReleaseControllerRevision(parent, revision); err != nil {
+				errlist = append(errlist, err)
+			}
+			continue
 		}
+
+		// It's an orphan.
+		if !match || parent.GetDeletionTimestamp() != nil || revision.DeletionTimestamp != nil ||
+			!isRevisionName(parent.GetName(), revision.Name) {
+			continue
+		}
+		if parentKind == nil {
+			gvk, err := apiutil.GVKForObject(parent.(runtime.Object), rh.Scheme())
+			if err != nil {
+				return nil, err
+			}
+			if err := rh.canAdopt(parent, gvk); err != nil {
+				return nil, err
+			}
+			parentKind = &gvk
+		}
+		adopted, err := rh.AdoptControllerRevision(parent, *parentKind, revision)
+		if err != nil {
+			// If the revision no longer exists, ignore the error.
+			if !errors.IsNotFound(err) {
+				errlist = append(errlist, err)
+			}
+			continue
+		}
+		claimed = append(claimed, adopted)
 	}
-	return owned, err
+	return claimed, utilerrors.NewAggregate(errlist)
+}
+
+// isRevisionName returns true if name is ControllerRevisionName(parentName, hash) for some hash. The hash is a
+// single segment, so the revisions of a parent named "<parent name>-<suffix>" don't match.
+func isRevisionName(parentName, name string) bool {
+	hash, ok := strings.CutPrefix(name, history.ControllerRevisionName(parentName, ""))
+	return ok && hash != "" && !strings.Contains(hash, "-")
 }
 
 func (rh *realHistory) CreateControllerRevision(parent metav1.Object, revision *apps.ControllerRevision, collisionCount *int32) (*apps.ControllerRevision, error) {
@@ -93,12 +152,62 @@ func (rh *realHistory) DeleteControllerRevision(revision *apps.ControllerRevisio
 	return rh.Delete(context.TODO(), revision)
 }
 
-// Unused but declared to saitisfy interface
+// canAdopt returns nil if parent still exists on the API server, has not been replaced and is not being deleted,
+// so that revisions are not adopted on behalf of a stale parent
+func (rh *realHistory) canAdopt(parent metav1.Object, parentKind schema.GroupVersionKind) error {
+	obj, err := rh.Scheme().New(parentKind)
+	if err != nil {
+		return err
+	}
+	fresh, ok := obj.(client.Object)
+	if !ok {
+		return fmt.Errorf("can't get parent %v/%v: fail to cast to client.Object", parent.GetNamespace(), parent.GetName())
+	}
+	if err := rh.Get(context.TODO(), client.ObjectKey{Namespace: parent.GetNamespace(), Name: parent.GetName()}, fresh); err != nil {
+		return err
+	}
+	if fresh.GetUID() != parent.GetUID() {
+		return fmt.Errorf("original parent %v/%v is gone: got uid %v, wanted %v",
+			parent.GetNamespace(), parent.GetName(), fresh.GetUID(), parent.GetUID())
+	}
+	if fresh.GetDeletionTimestamp() != nil {
+		return fmt.Errorf("%v/%v has just been deleted at %v", parent.GetNamespace(), parent.GetName(), fresh.GetDeletionTimestamp())
+	}
+	return nil
+}
+
+// AdoptControllerRevision makes parent the controller of the orphaned revision. The update fails on a conflict
+// if the revision has changed, e.g. because someone else adopted it first.
 func (rh *realHistory) AdoptControllerRevision(parent metav1.Object, parentKind schema.GroupVersionKind, revision *apps.ControllerRevision) (*apps.ControllerRevision, error) {
-	panic("unimplemented")
+	if owner := metav1.GetControllerOf(revision); owner != nil {
+		return nil, fmt.Errorf("attempt to adopt revision owned by %v", owner)
+	}
+	clone := revision.DeepCopy()
+	clone.OwnerReferences = append(clone.OwnerReferences, *metav1.NewControllerRef(parent, parentKind))
+	if err := rh.Update(context.TODO(), clone); err != nil {
+		return nil, fmt.Errorf("can't adopt ControllerRevision %v/%v (%v): %v", revision.Namespace, revision.Name, revision.UID, err)
+	}
+	return clone, nil
 }
 
-// Unused but declared to saitisfy interface
+// ReleaseControllerRevision removes the owner reference to parent from the revision. A revision that no longer
+// exists is ignored, returning nil.
 func (rh *realHistory) ReleaseControllerRevision(parent metav1.Object, revision *apps.ControllerRevision) (*apps.ControllerRevision, error) {
-	panic("unimplemented")
+	clone := revision.DeepCopy()
+	clone.OwnerReferences = nil
+	for _, ref := range revision.OwnerReferences {
+		if ref.UID != parent.GetUID() {
+			clone.OwnerReferences = append(clone.OwnerReferences, ref)
+		}
+	}
+	if len(clone.OwnerReferences) == len(revision.OwnerReferences) {
+		return revision, nil
+	}
+	if err := rh.Update(context.TODO(), clone); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can't release ControllerRevision %v/%v (%v): %v", revision.Namespace, revision.Name, revision.UID, err)
+	}
+	return clone, nil
 }
@@ -1,6 +1,7 @@
 package history
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -10,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/kubernetes/pkg/controller/history"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
@@ -98,3 +100,71 @@ func TestRevisionHistory(t *testing.T) {
 		t.Fatalf("Expected no ControllerRevision left, got %v", gotRevisions)
 	}
 }
+
+func TestClaimControllerRevisions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := workloadv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := apps.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parent-pw", UID: uuid.NewUUID()},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test-app"}},
+		},
+	}
+	other := &workloadv1alpha1.PartitionWorkload{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: uuid.NewUUID()}}
+	kind := workloadv1alpha1.GroupVersion.WithKind("PartitionWorkload")
+	matching := map[string]string{"app": "test-app"}
+
+	newRevision := func(name string, labels map[string]string, owner metav1.Object) *apps.ControllerRevision {
+		revision := &apps.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels},
+		}
+		if owner != nil {
+			revision.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, kind)}
+		}
+		return revision
+	}
+	owned := newRevision("parent-pw-1", matching, parent)
+	stale := newRevision("parent-pw-2", map[string]string{"app": "other"}, parent)
+	orphan := newRevision("parent-pw-3", matching, nil)
+	foreignOrphan := newRevision("statefulset-4", matching, nil)
+	// An orphan of a PartitionWorkload named parent-pw-canary
+	prefixedOrphan := newRevision("parent-pw-canary-6", matching, nil)
+	foreign := newRevision("other-5", matching, other)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(parent, owned, stale, orphan, foreignOrphan, prefixedOrphan, foreign).Build()
+	historyControl := NewHistory(fakeClient)
+
+	selector, _ := metav1.LabelSelectorAsSelector(parent.Spec.Selector)
+	gotRevisions, err := historyControl.ListControllerRevisions(parent, selector)
+	if err != nil {
+		t.Fatalf("Failed to list revisions: %v", err)
+	}
+	var names []string
+	for _, revision := range gotRevisions {
+		names = append(names, revision.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"parent-pw-1", "parent-pw-3"}) {
+		t.Fatalf("Expected the owned and the adopted revisions, got %v", names)
+	}
+
+	for name, wantOwned := range map[string]bool{
+		"parent-pw-1": true, "parent-pw-2": false, "parent-pw-3": true, "statefulset-4": false, "other-5": false,
+		"parent-pw-canary-6": false,
+	} {
+		revision := &apps.ControllerRevision{}
+		if err := fakeClient.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: name}, revision); err != nil {
+			t.Fatal(err)
+		}
+		ref := metav1.GetControllerOf(revision)
+		if gotOwned := ref != nil && ref.UID == parent.UID; gotOwned != wantOwned {
+			t.Errorf("Expected revision %s to be owned: %v, got owner references %v", name, wantOwned, revision.OwnerReferences)
+		}
+	}
+}
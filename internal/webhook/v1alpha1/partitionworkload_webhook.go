@@ -18,14 +18,35 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"strconv"
 
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/kubernetes/pkg/apis/core"
+	corev1 "k8s.io/kubernetes/pkg/apis/core/v1"
+	corevalidation "k8s.io/kubernetes/pkg/apis/core/validation"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/analysis"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/revision"
+	"github.com/2170chm/k8s-partition-workload/internal/controller/sync"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
@@ -33,17 +54,81 @@ import (
 // log is for logging in this package.
 var partitionworkloadlog = logf.Log.WithName("partitionworkload-resource")
 
+// coreScheme defaults pod templates and converts them to the internal core types for validation
+var coreScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(core.AddToScheme(coreScheme))
+	utilruntime.Must(corev1.AddToScheme(coreScheme))
+}
+
 // SetupPartitionWorkloadWebhookWithManager registers the webhook for PartitionWorkload in the manager.
 func SetupPartitionWorkloadWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr, &workloadv1alpha1.PartitionWorkload{}).
-		WithValidator(&PartitionWorkloadCustomValidator{}).
+		WithValidator(&PartitionWorkloadCustomValidator{Client: mgr.GetAPIReader()}).
+		WithDefaulter(&PartitionWorkloadCustomDefaulter{}).
 		Complete()
 }
 
 // TODO(user): EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 
+// +kubebuilder:webhook:path=/mutate-workload-scott-dev-v1alpha1-partitionworkload,mutating=true,failurePolicy=fail,sideEffects=None,groups=workload.scott.dev,resources=partitionworkloads,verbs=create;update,versions=v1alpha1,name=mpartitionworkload-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// PartitionWorkloadCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind PartitionWorkload when those are created or updated, so that the stored object shows the configuration
+// the controller acts on. spec.partition and spec.revisionHistoryLimit are left unset: the scale subresource
+// bypasses this webhook, so a defaulted partition would fall behind replicas, and an unset history limit
+// follows the --default-revision-history-limit of the controller.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as it is used only for temporary operations and does not need to be deeply copied.
+type PartitionWorkloadCustomDefaulter struct{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind PartitionWorkload.
+func (d *PartitionWorkloadCustomDefaulter) Default(_ context.Context, obj *workloadv1alpha1.PartitionWorkload) error {
+	partitionworkloadlog.Info("Defaulting for PartitionWorkload", "name", obj.GetName())
+	applyDefaults(obj)
+	return nil
+}
+
+// applyDefaults fills in the unset fields of obj with the values the controller would otherwise assume
+func applyDefaults(obj *workloadv1alpha1.PartitionWorkload) {
+	spec := &obj.Spec
+	if spec.Replicas == nil {
+		spec.Replicas = ptr.To[int32](1)
+	}
+	spec.PodNaming = sync.PodNaming(obj)
+	if spec.AdoptionPolicy == "" {
+		spec.AdoptionPolicy = workloadv1alpha1.AdoptionPolicyAlways
+	}
+
+	if len(spec.VolumeClaimTemplates) > 0 {
+		if spec.PersistentVolumeClaimRetentionPolicy == nil {
+			spec.PersistentVolumeClaimRetentionPolicy = &apps.StatefulSetPersistentVolumeClaimRetentionPolicy{}
+		}
+		policy := spec.PersistentVolumeClaimRetentionPolicy
+		if policy.WhenDeleted == "" {
+			policy.WhenDeleted = apps.RetainPersistentVolumeClaimRetentionPolicyType
+		}
+		if policy.WhenScaled == "" {
+			policy.WhenScaled = apps.RetainPersistentVolumeClaimRetentionPolicyType
+		}
+	}
+
+	if spec.Analysis != nil {
+		if spec.Analysis.Interval == nil {
+			spec.Analysis.Interval = &metav1.Duration{Duration: analysis.DefaultInterval}
+		}
+		if spec.Analysis.FailurePolicy == "" {
+			spec.Analysis.FailurePolicy = workloadv1alpha1.AnalysisFailurePolicyHold
+		}
+	}
+}
+
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 // NOTE: If you want to customise the 'path', use the flags '--defaulting-path' or '--validation-path'.
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=list
+
 // +kubebuilder:webhook:path=/validate-workload-scott-dev-v1alpha1-partitionworkload,mutating=false,failurePolicy=fail,sideEffects=None,groups=workload.scott.dev,resources=partitionworkloads,verbs=create;update,versions=v1alpha1,name=vpartitionworkload-v1alpha1.kb.io,admissionReviewVersions=v1
 
 // PartitionWorkloadCustomValidator struct is responsible for validating the PartitionWorkload resource
@@ -52,78 +137,338 @@ func SetupPartitionWorkloadWebhookWithManager(mgr ctrl.Manager) error {
 // NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
 // as this struct is used only for temporary operations and does not need to be deeply copied.
 type PartitionWorkloadCustomValidator struct {
-	// TODO(user): Add more fields as needed for validation
+	// Client lists the workloads in the namespace of a PartitionWorkload to detect overlapping selectors.
+	// The check is skipped when it is nil.
+	Client client.Reader
 }
 
 // ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type PartitionWorkload.
-func (v *PartitionWorkloadCustomValidator) ValidateCreate(_ context.Context, obj *workloadv1alpha1.PartitionWorkload) (admission.Warnings, error) {
+func (v *PartitionWorkloadCustomValidator) ValidateCreate(ctx context.Context, obj *workloadv1alpha1.PartitionWorkload) (admission.Warnings, error) {
 	partitionworkloadlog.Info("Validation for PartitionWorkload upon creation", "name", obj.GetName())
-	var allErrs field.ErrorList
+	return v.validate(ctx, nil, obj)
+}
 
-	partition := obj.Spec.Partition
-	replicas := obj.Spec.Replicas
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type PartitionWorkload.
+func (v *PartitionWorkloadCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *workloadv1alpha1.PartitionWorkload) (admission.Warnings, error) {
+	partitionworkloadlog.Info("Validation for PartitionWorkload upon update", "name", newObj.GetName())
+	return v.validate(ctx, oldObj, newObj)
+}
 
-	if partition == nil {
-		return nil, nil
-	}
-	if replicas == nil {
-		if *partition > 1 {
-			allErrs = append(allErrs,
-				field.Invalid(field.NewPath("spec", "partition"), *partition, "must be <= 1 when spec.replicas is nil"),
-			)
-		}
-	} else {
-		if *partition > *replicas {
-			allErrs = append(allErrs,
-				field.Invalid(field.NewPath("spec", "partition"), *partition, "must be <= spec.replicas"),
-			)
+// validate validates obj, and its changes from oldObj on update. oldObj is nil on create.
+// It returns an Invalid error listing every problem found, or nil.
+func (v *PartitionWorkloadCustomValidator) validate(ctx context.Context, oldObj, obj *workloadv1alpha1.PartitionWorkload) (admission.Warnings, error) {
+	allErrs := validatePartitionWorkload(oldObj, obj)
+
+	var warnings admission.Warnings
+	// Overlaps are only meaningful for a valid selector, and can only appear when the selected labels change
+	if len(allErrs) == 0 && (oldObj == nil || !apiequality.Semantic.DeepEqual(oldObj.Spec.Template.Labels, obj.Spec.Template.Labels)) {
+		var errs field.ErrorList
+		var err error
+		warnings, errs, err = v.validateSelectorOverlap(ctx, obj, field.NewPath("spec", "selector"))
+		if err != nil {
+			return nil, err
 		}
+		allErrs = append(allErrs, errs...)
 	}
 
 	if len(allErrs) > 0 {
-		return nil, apierrors.NewInvalid(
+		return warnings, apierrors.NewInvalid(
 			schema.GroupKind{Group: "workload.scott.dev", Kind: "PartitionWorkload"},
 			obj.GetName(),
 			allErrs,
 		)
 	}
-	return nil, nil
+	return warnings, nil
 }
 
-// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type PartitionWorkload.
-func (v *PartitionWorkloadCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj *workloadv1alpha1.PartitionWorkload) (admission.Warnings, error) {
-	partitionworkloadlog.Info("Validation for PartitionWorkload upon creation", "name", newObj.GetName())
+// validatePartitionWorkload validates the spec of obj, and its changes from oldObj on update. oldObj is nil on create.
+func validatePartitionWorkload(oldObj, obj *workloadv1alpha1.PartitionWorkload) field.ErrorList {
 	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
 
-	partition := newObj.Spec.Partition
-	replicas := newObj.Spec.Replicas
+	allErrs = append(allErrs, validateSelector(&obj.Spec, specPath)...)
+	allErrs = append(allErrs, validatePodTemplate(&obj.Spec, specPath.Child("template"))...)
+	allErrs = append(allErrs, validatePartition(oldObj, obj, specPath.Child("partition"))...)
+	allErrs = append(allErrs, validateVolumeClaimTemplates(&obj.Spec, specPath)...)
+	allErrs = append(allErrs, validateCanaryOverrides(&obj.Spec, specPath.Child("canaryOverrides"))...)
+	allErrs = append(allErrs, validateRevisionHistoryLimit(&obj.Spec, specPath.Child("revisionHistoryLimit"))...)
+	allErrs = append(allErrs, validateRevisionHashIgnore(&obj.Spec, specPath.Child("revisionHashIgnore"))...)
+	allErrs = append(allErrs, validateAnalysis(&obj.Spec, specPath.Child("analysis"))...)
 
-	if partition == nil {
-		return nil, nil
+	if oldObj != nil {
+		if !apiequality.Semantic.DeepEqual(oldObj.Spec.Selector, obj.Spec.Selector) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("selector"), "field is immutable"))
+		}
+		if !apiequality.Semantic.DeepEqual(oldObj.Spec.VolumeClaimTemplates, obj.Spec.VolumeClaimTemplates) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("volumeClaimTemplates"), "field is immutable"))
+		}
 	}
-	if replicas == nil {
-		if *partition > 1 {
-			allErrs = append(allErrs,
-				field.Invalid(field.NewPath("spec", "partition"), *partition, "must be <= 1 when spec.replicas is nil"),
-			)
+	return allErrs
+}
+
+// validateSelectorOverlap looks for workloads in the namespace of obj whose pods obj would fight over. Overlapping
+// another PartitionWorkload is an error, while overlapping a Deployment only warns, as it may be on its way out.
+// Selectors overlap when either one selects the pod template labels of the other.
+func (v *PartitionWorkloadCustomValidator) validateSelectorOverlap(ctx context.Context, obj *workloadv1alpha1.PartitionWorkload, fldPath *field.Path) (
+	admission.Warnings, field.ErrorList, error,
+) {
+	if v.Client == nil {
+		return nil, nil, nil
+	}
+	var warnings admission.Warnings
+	var allErrs field.ErrorList
+
+	pws := &workloadv1alpha1.PartitionWorkloadList{}
+	if err := v.Client.List(ctx, pws, client.InNamespace(obj.Namespace)); err != nil {
+		return nil, nil, err
+	}
+	for i := range pws.Items {
+		other := &pws.Items[i]
+		if other.Name == obj.Name || other.DeletionTimestamp != nil {
+			continue
 		}
-	} else {
-		if *partition > *replicas {
-			allErrs = append(allErrs,
-				field.Invalid(field.NewPath("spec", "partition"), *partition, "must be <= spec.replicas"),
-			)
+		if selectorsOverlap(obj.Spec.Selector, obj.Spec.Template.Labels, other.Spec.Selector, other.Spec.Template.Labels) {
+			allErrs = append(allErrs, field.Invalid(fldPath, obj.Spec.Selector,
+				fmt.Sprintf("overlaps with the selector of PartitionWorkload %s", other.Name)))
 		}
 	}
 
+	deployments := &apps.DeploymentList{}
+	if err := v.Client.List(ctx, deployments, client.InNamespace(obj.Namespace)); err != nil {
+		return nil, nil, err
+	}
+	for i := range deployments.Items {
+		other := &deployments.Items[i]
+		// The Deployment we migrate from overlaps on purpose
+		if other.DeletionTimestamp != nil || other.Name == obj.Annotations[workloadv1alpha1.MigrateFromAnnotationKey] {
+			continue
+		}
+		if selectorsOverlap(obj.Spec.Selector, obj.Spec.Template.Labels, other.Spec.Selector, other.Spec.Template.Labels) {
+			warnings = append(warnings, fmt.Sprintf("%s overlaps with the selector of Deployment %s, "+
+				"the two will fight over the pods they both select", fldPath, other.Name))
+		}
+	}
+	return warnings, allErrs, nil
+}
+
+// selectorsOverlap returns true if either selector selects the pod template labels of the other workload
+func selectorsOverlap(selector *metav1.LabelSelector, templateLabels map[string]string,
+	otherSelector *metav1.LabelSelector, otherTemplateLabels map[string]string,
+) bool {
+	matches := func(selector *metav1.LabelSelector, set map[string]string) bool {
+		s, err := metav1.LabelSelectorAsSelector(selector)
+		// A nil selector converts to one matching nothing
+		return err == nil && !s.Empty() && s.Matches(labels.Set(set))
+	}
+	return matches(selector, otherTemplateLabels) || matches(otherSelector, templateLabels)
+}
+
+// validateSelector checks that the selector is set, valid, not empty and selects the pod template's labels
+func validateSelector(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	selectorPath := fldPath.Child("selector")
+	if spec.Selector == nil {
+		return field.ErrorList{field.Required(selectorPath, "")}
+	}
+
+	allErrs := metav1validation.ValidateLabelSelector(spec.Selector, metav1validation.LabelSelectorValidationOptions{}, selectorPath)
 	if len(allErrs) > 0 {
-		return nil, apierrors.NewInvalid(
-			schema.GroupKind{Group: "workload.scott.dev", Kind: "PartitionWorkload"},
-			newObj.GetName(),
-			allErrs,
+		return allErrs
+	}
+	if len(spec.Selector.MatchLabels)+len(spec.Selector.MatchExpressions) == 0 {
+		return field.ErrorList{field.Invalid(selectorPath, spec.Selector, "empty selector is invalid for PartitionWorkload")}
+	}
+	selector, err := metav1.LabelSelectorAsSelector(spec.Selector)
+	if err != nil {
+		return field.ErrorList{field.Invalid(selectorPath, spec.Selector, err.Error())}
+	}
+	if !selector.Matches(labels.Set(spec.Template.Labels)) {
+		return field.ErrorList{field.Invalid(fldPath.Child("template", "metadata", "labels"), spec.Template.Labels,
+			"`selector` does not match template `labels`")}
+	}
+	return nil
+}
+
+// validatePodTemplate runs the core validation of pod templates on the template, defaulted the way the
+// API server defaults the templates of built-in workloads. Like theirs, the restart policy must be Always.
+func validatePodTemplate(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	template := &v1.PodTemplate{Template: *spec.Template.DeepCopy()}
+	coreScheme.Default(template)
+
+	coreTemplate := &core.PodTemplateSpec{}
+	if err := coreScheme.Convert(&template.Template, coreTemplate, nil); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, nil, err.Error())}
+	}
+	allErrs := corevalidation.ValidatePodTemplateSpec(coreTemplate, fldPath, corevalidation.PodValidationOptions{})
+	if coreTemplate.Spec.RestartPolicy != core.RestartPolicyAlways {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("spec", "restartPolicy"),
+			coreTemplate.Spec.RestartPolicy, []core.RestartPolicy{core.RestartPolicyAlways}))
+	}
+	return allErrs
+}
+
+// validatePartition checks the partition against replicas. On update only a changed partition is checked;
+// scaling below the partition, e.g. by a HorizontalPodAutoscaler, is allowed and the controller clamps the
+// partition to replicas.
+func validatePartition(oldObj, obj *workloadv1alpha1.PartitionWorkload, fldPath *field.Path) field.ErrorList {
+	partition := obj.Spec.Partition
+	if partition == nil || (oldObj != nil && apiequality.Semantic.DeepEqual(oldObj.Spec.Partition, partition)) {
+		return nil
+	}
+	if replicas := obj.Spec.Replicas; replicas == nil && *partition > 1 {
+		return field.ErrorList{field.Invalid(fldPath, *partition, "must be <= 1 when spec.replicas is nil")}
+	} else if replicas != nil && *partition > *replicas {
+		return field.ErrorList{field.Invalid(fldPath, *partition, "must be <= spec.replicas")}
+	}
+	return nil
+}
+
+// validateVolumeClaimTemplates checks that claim templates have unique names and that pods get the
+// instance IDs claims are created for
+func validateVolumeClaimTemplates(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+	if spec.PodNaming == workloadv1alpha1.PodNamingGenerated {
+		allErrs = append(allErrs,
+			field.Invalid(fldPath.Child("podNaming"), spec.PodNaming, "must be Random or Ordinal when spec.volumeClaimTemplates is set"),
 		)
 	}
+	names := map[string]bool{}
+	for i, tmpl := range spec.VolumeClaimTemplates {
+		path := fldPath.Child("volumeClaimTemplates").Index(i).Child("metadata", "name")
+		switch {
+		case tmpl.Name == "":
+			allErrs = append(allErrs, field.Required(path, ""))
+		case names[tmpl.Name]:
+			allErrs = append(allErrs, field.Duplicate(path, tmpl.Name))
+		}
+		names[tmpl.Name] = true
+	}
+	return allErrs
+}
 
-	return nil, nil
+// validateCanaryOverrides checks that the canary overrides apply cleanly to the pod template
+func validateCanaryOverrides(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	if spec.CanaryOverrides == nil || len(spec.CanaryOverrides.Raw) == 0 {
+		return nil
+	}
+	if _, err := revision.PatchTemplate(&spec.Template, spec.CanaryOverrides.Raw); err != nil {
+		return field.ErrorList{
+			field.Invalid(fldPath, string(spec.CanaryOverrides.Raw), err.Error()),
+		}
+	}
+	return nil
+}
+
+// validateAnalysis checks that the interval is positive, that the metric queries render and that their bounds are
+// numbers forming a range. The analysis only evaluates them once a rollout starts, where a mistake would hold it.
+func validateAnalysis(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	if spec.Analysis == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	if interval := spec.Analysis.Interval; interval != nil && interval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("interval"), interval.Duration.String(), "must be greater than 0"))
+	}
+	for i, metric := range spec.Analysis.Metrics {
+		path := fldPath.Child("metrics").Index(i)
+		if err := analysis.ValidateQuery(metric.Query); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("query"), metric.Query, err.Error()))
+		}
+		min, minErrs := parseBound(metric.Min, path.Child("min"))
+		max, maxErrs := parseBound(metric.Max, path.Child("max"))
+		allErrs = append(append(allErrs, minErrs...), maxErrs...)
+		if min != nil && max != nil && *min > *max {
+			allErrs = append(allErrs, field.Invalid(path.Child("min"), *metric.Min, "must be less than or equal to max"))
+		}
+	}
+	return allErrs
+}
+
+// parseBound returns the value of a metric bound, or nil if it is unset or not a finite number
+func parseBound(bound *string, fldPath *field.Path) (*float64, field.ErrorList) {
+	if bound == nil {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(*bound, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, field.ErrorList{field.Invalid(fldPath, *bound, "must be a finite decimal number")}
+	}
+	return &value, nil
+}
+
+// validateRevisionHistoryLimit checks that the revision history limit is not negative
+func validateRevisionHistoryLimit(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	if spec.RevisionHistoryLimit == nil || *spec.RevisionHistoryLimit >= 0 {
+		return nil
+	}
+	return field.ErrorList{
+		field.Invalid(fldPath, *spec.RevisionHistoryLimit, "must be >= 0"),
+	}
+}
+
+// reservedPodLabels are set on pods by the controller, so they can't be left out of revisions
+var reservedPodLabels = sets.New(
+	apps.ControllerRevisionHashLabelKey,
+	apps.DefaultDeploymentUniqueLabelKey,
+	workloadv1alpha1.RoleLabelKey,
+	workloadv1alpha1.InstanceIDLabelKey,
+)
+
+// validateRevisionHashIgnore checks that the ignored labels and annotations are valid keys and that the selector
+// doesn't use the ignored labels, as pods would stop matching it. Paths must point into the pod spec; labels and
+// annotations are listed by key.
+func validateRevisionHashIgnore(spec *workloadv1alpha1.PartitionWorkloadSpec, fldPath *field.Path) field.ErrorList {
+	ignore := spec.RevisionHashIgnore
+	if ignore == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+
+	selected := sets.New[string]()
+	if spec.Selector != nil {
+		for key := range spec.Selector.MatchLabels {
+			selected.Insert(key)
+		}
+		for _, expr := range spec.Selector.MatchExpressions {
+			selected.Insert(expr.Key)
+		}
+	}
+	for i, key := range ignore.Labels {
+		idxPath := fldPath.Child("labels").Index(i)
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, msg))
+		}
+		if selected.Has(key) {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, "label is used by `selector`"))
+		}
+		if reservedPodLabels.Has(key) {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, "label is set by the controller"))
+		}
+	}
+	for i, key := range ignore.Annotations {
+		idxPath := fldPath.Child("annotations").Index(i)
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, msg))
+		}
+		if key == workloadv1alpha1.CanaryOverridesAnnotationKey {
+			allErrs = append(allErrs, field.Invalid(idxPath, key, "annotation is set by the controller"))
+		}
+	}
+	for i, path := range ignore.Paths {
+		idxPath := fldPath.Child("paths").Index(i)
+		tokens, err := revision.ParsePointer(path)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(idxPath, path, err.Error()))
+			continue
+		}
+		if !revision.IsMutablePodPath(tokens) {
+			allErrs = append(allErrs, field.Invalid(idxPath, path, "must point at a pod field that can be updated in place: "+
+				"/spec/containers/<index>/image, /spec/initContainers/<index>/image, /spec/activeDeadlineSeconds or /spec/tolerations"))
+		}
+	}
+	return allErrs
 }
 
 // ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type PartitionWorkload.
@@ -17,11 +17,20 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
-	// TODO (user): Add any additional imports if needed
 )
 
 var _ = Describe("PartitionWorkload Webhook", func() {
@@ -29,12 +38,14 @@ var _ = Describe("PartitionWorkload Webhook", func() {
 		obj       *workloadv1alpha1.PartitionWorkload
 		oldObj    *workloadv1alpha1.PartitionWorkload
 		validator PartitionWorkloadCustomValidator
+		defaulter PartitionWorkloadCustomDefaulter
 	)
 
 	BeforeEach(func() {
 		obj = &workloadv1alpha1.PartitionWorkload{}
 		oldObj = &workloadv1alpha1.PartitionWorkload{}
 		validator = PartitionWorkloadCustomValidator{}
+		defaulter = PartitionWorkloadCustomDefaulter{}
 		Expect(validator).NotTo(BeNil(), "Expected validator to be initialized")
 		Expect(oldObj).NotTo(BeNil(), "Expected oldObj to be initialized")
 		Expect(obj).NotTo(BeNil(), "Expected obj to be initialized")
@@ -44,27 +55,287 @@ var _ = Describe("PartitionWorkload Webhook", func() {
 		// TODO (user): Add any teardown logic common to all tests
 	})
 
+	Context("When creating PartitionWorkload under Defaulting Webhook", func() {
+		It("Should fill in the effective configuration", func() {
+			obj.Spec.Analysis = &workloadv1alpha1.Analysis{Address: "http://prometheus:9090"}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Replicas).To(Equal(ptr.To[int32](1)))
+			Expect(obj.Spec.Partition).To(BeNil())
+			Expect(obj.Spec.RevisionHistoryLimit).To(BeNil())
+			Expect(obj.Spec.PodNaming).To(Equal(workloadv1alpha1.PodNamingGenerated))
+			Expect(obj.Spec.AdoptionPolicy).To(Equal(workloadv1alpha1.AdoptionPolicyAlways))
+			Expect(obj.Spec.PersistentVolumeClaimRetentionPolicy).To(BeNil())
+			Expect(obj.Spec.Analysis.Interval).To(Equal(&metav1.Duration{Duration: time.Minute}))
+			Expect(obj.Spec.Analysis.FailurePolicy).To(Equal(workloadv1alpha1.AnalysisFailurePolicyHold))
+		})
+
+		It("Should not override values that are set", func() {
+			obj.Spec.Replicas, obj.Spec.Partition = ptr.To[int32](5), ptr.To[int32](2)
+			obj.Spec.RevisionHistoryLimit = ptr.To[int32](3)
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Partition).To(Equal(ptr.To[int32](2)))
+			Expect(obj.Spec.RevisionHistoryLimit).To(Equal(ptr.To[int32](3)))
+		})
+
+		It("Should default the naming and retention policy of volume claim templates", func() {
+			obj.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{newClaimTemplate("data")}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.PodNaming).To(Equal(workloadv1alpha1.PodNamingOrdinal))
+			Expect(obj.Spec.PersistentVolumeClaimRetentionPolicy).To(Equal(&apps.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: apps.RetainPersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  apps.RetainPersistentVolumeClaimRetentionPolicyType,
+			}))
+		})
+	})
+
 	Context("When creating or updating PartitionWorkload under Validating Webhook", func() {
-		// TODO (user): Add logic for validating webhooks
-		// Example:
-		// It("Should deny creation if a required field is missing", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = ""
-		//     Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
-		// })
-		//
-		// It("Should admit creation if all required fields are present", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = "valid_value"
-		//     Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
-		// })
-		//
-		// It("Should validate updates correctly", func() {
-		//     By("simulating a valid update scenario")
-		//     oldObj.SomeRequiredField = "updated_value"
-		//     obj.SomeRequiredField = "updated_value"
-		//     Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
-		// })
+		BeforeEach(func() {
+			obj, oldObj = newValidWorkload(), newValidWorkload()
+		})
+
+		It("Should admit a valid PartitionWorkload", func() {
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a missing selector", func() {
+			obj.Spec.Selector = nil
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny an empty selector", func() {
+			obj.Spec.Selector = &metav1.LabelSelector{}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny an invalid selector", func() {
+			obj.Spec.Selector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpIn},
+			}}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny a selector that doesn't match the template labels", func() {
+			obj.Spec.Template.Labels = map[string]string{"app": "other"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny changes to the selector", func() {
+			obj.Spec.Selector.MatchLabels = map[string]string{"app": "test", "tier": "web"}
+			obj.Spec.Template.Labels = map[string]string{"app": "test", "tier": "web"}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny a selector overlapping another PartitionWorkload", func() {
+			other := newValidWorkload()
+			other.Name = "other"
+			validator.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(other).Build()
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should warn about a selector overlapping a Deployment", func() {
+			deployment := &apps.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: obj.Namespace},
+				Spec: apps.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+					Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test", "tier": "web"}}},
+				},
+			}
+			validator.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(deployment).Build()
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(HaveLen(1))
+		})
+
+		It("Should admit selectors that don't overlap", func() {
+			other := newValidWorkload()
+			other.Name = "other"
+			other.Spec.Selector.MatchLabels = map[string]string{"app": "other"}
+			other.Spec.Template.Labels = map[string]string{"app": "other"}
+			validator.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(other).Build()
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeEmpty())
+		})
+
+		It("Should deny a pod template that fails core validation", func() {
+			obj.Spec.Template.Spec.Containers[0].Image = ""
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny a restart policy other than Always", func() {
+			obj.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny volume claim templates with the Generated naming policy", func() {
+			obj.Spec.PodNaming = workloadv1alpha1.PodNamingGenerated
+			obj.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{newClaimTemplate("data")}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny volume claim templates with duplicate names", func() {
+			obj.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{newClaimTemplate("data"), newClaimTemplate("data")}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should admit volume claim templates with the default naming policy", func() {
+			obj.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{newClaimTemplate("data")}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny changes to volume claim templates", func() {
+			oldObj.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{newClaimTemplate("data")}
+			obj.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{newClaimTemplate("cache")}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny canary overrides that don't apply to the pod template", func() {
+			obj.Spec.CanaryOverrides = &runtime.RawExtension{Raw: []byte(`{"spec":{"containers":"nginx"}}`)}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should admit canary overrides that apply to the pod template", func() {
+			obj.Spec.CanaryOverrides = &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"track":"canary"}}}`)}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should admit scaling replicas below an unchanged partition", func() {
+			oldObj.Spec.Replicas, oldObj.Spec.Partition = ptr.To[int32](5), ptr.To[int32](4)
+			obj.Spec.Replicas, obj.Spec.Partition = ptr.To[int32](2), ptr.To[int32](4)
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny changing the partition above replicas", func() {
+			oldObj.Spec.Replicas, oldObj.Spec.Partition = ptr.To[int32](5), ptr.To[int32](4)
+			obj.Spec.Replicas, obj.Spec.Partition = ptr.To[int32](3), ptr.To[int32](5)
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny a negative revision history limit", func() {
+			obj.Spec.RevisionHistoryLimit = ptr.To[int32](-1)
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should admit a zero revision history limit", func() {
+			obj.Spec.RevisionHistoryLimit = ptr.To[int32](0)
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should admit fields left out of revisions", func() {
+			obj.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{
+				Labels:      []string{"build"},
+				Annotations: []string{"ci.example.com/build-id"},
+				Paths:       []string{"/spec/containers/0/image", "/spec/activeDeadlineSeconds", "/spec/tolerations"},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny ignoring a label used by the selector", func() {
+			obj.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{Labels: []string{"app"}}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("label is used by `selector`")))
+		})
+
+		It("Should deny ignoring labels set by the controller", func() {
+			for _, key := range []string{
+				apps.ControllerRevisionHashLabelKey, apps.DefaultDeploymentUniqueLabelKey,
+				workloadv1alpha1.RoleLabelKey, workloadv1alpha1.InstanceIDLabelKey,
+			} {
+				obj.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{Labels: []string{key}}
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("label is set by the controller")), key)
+			}
+		})
+
+		It("Should admit a valid analysis", func() {
+			obj.Spec.Analysis = newValidAnalysis()
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny analysis bounds that are not numbers", func() {
+			for _, bound := range []string{"0.5%", "NaN", "+Inf", ""} {
+				obj.Spec.Analysis = newValidAnalysis()
+				obj.Spec.Analysis.Metrics[0].Min = ptr.To(bound)
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("must be a finite decimal number")), bound)
+				obj.Spec.Analysis = newValidAnalysis()
+				obj.Spec.Analysis.Metrics[0].Max = ptr.To(bound)
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("must be a finite decimal number")), bound)
+			}
+		})
+
+		It("Should deny an analysis min above its max", func() {
+			obj.Spec.Analysis = newValidAnalysis()
+			obj.Spec.Analysis.Metrics[0].Min = ptr.To("0.5")
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("must be less than or equal to max")))
+		})
+
+		It("Should deny analysis queries that don't render", func() {
+			for _, query := range []string{`rate(x{rev="{{ .UpdateRevision }"}[1m])`, `up{rev="{{ .Revision }}"}`} {
+				obj.Spec.Analysis = newValidAnalysis()
+				obj.Spec.Analysis.Metrics[0].Query = query
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("invalid query template")), query)
+			}
+		})
+
+		It("Should deny a non-positive analysis interval", func() {
+			for _, interval := range []time.Duration{0, -time.Minute} {
+				obj.Spec.Analysis = newValidAnalysis()
+				obj.Spec.Analysis.Interval = &metav1.Duration{Duration: interval}
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("must be greater than 0")), interval.String())
+			}
+		})
+
+		It("Should deny ignoring the canary overrides annotation", func() {
+			obj.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{
+				Annotations: []string{workloadv1alpha1.CanaryOverridesAnnotationKey},
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("annotation is set by the controller")))
+		})
+
+		It("Should deny ignored paths that can't be updated in place", func() {
+			for _, path := range []string{
+				"spec/containers", "/metadata/labels/build", "/spec", "/spec/terminationGracePeriodSeconds", "/spec/containers/0/env",
+			} {
+				obj.Spec.RevisionHashIgnore = &workloadv1alpha1.RevisionHashIgnore{Paths: []string{path}}
+				Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred(), path)
+			}
+		})
 	})
 
 })
+
+func newValidWorkload() *workloadv1alpha1.PartitionWorkload {
+	return &workloadv1alpha1.PartitionWorkload{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: workloadv1alpha1.PartitionWorkloadSpec{
+			Replicas: ptr.To[int32](1),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "nginx", Image: "nginx"}},
+				},
+			},
+		},
+	}
+}
+
+func newValidAnalysis() *workloadv1alpha1.Analysis {
+	return &workloadv1alpha1.Analysis{
+		Address:  "http://prometheus:9090",
+		Interval: &metav1.Duration{Duration: time.Minute},
+		Metrics: []workloadv1alpha1.AnalysisMetric{{
+			Name:  "error-rate",
+			Query: `sum(rate(errors{pod_template_hash="{{ .UpdateRevisionHash }}"}[5m]))`,
+			Max:   ptr.To("0.01"),
+		}},
+	}
+}
+
+func newClaimTemplate(name string) v1.PersistentVolumeClaim {
+	return v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+		},
+	}
+}
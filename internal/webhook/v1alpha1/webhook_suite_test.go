@@ -40,6 +40,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	workloadv1alpha1 "github.com/2170chm/k8s-partition-workload/api/v1alpha1"
+	workloadv1beta1 "github.com/2170chm/k8s-partition-workload/api/v1beta1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -68,6 +69,8 @@ var _ = BeforeSuite(func() {
 	var err error
 	err = workloadv1alpha1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = workloadv1beta1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:scheme
 